@@ -0,0 +1,122 @@
+// Package achievements holds the badge catalog and the facts the badges are
+// judged on. It has no database access; callers gather habit inputs and
+// persist whatever unlocks.
+package achievements
+
+import (
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/stats"
+)
+
+// Metric names a number measured across all of a user's habits.
+type Metric string
+
+const (
+	// MetricEntries counts every entry logged on a build habit.
+	MetricEntries Metric = "entries"
+	// MetricStreak is the longest streak reached by any daily habit.
+	MetricStreak Metric = "streak"
+	// MetricPerfectDays is the longest run of consecutive days on which
+	// every daily habit was done.
+	MetricPerfectDays Metric = "perfect_days"
+)
+
+// Facts holds the current value of each metric.
+type Facts map[Metric]int
+
+// Rule unlocks a badge once Metric reaches Threshold.
+type Rule struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Metric      Metric `json:"metric"`
+	Threshold   int    `json:"threshold"`
+}
+
+// Rules is the badge catalog. New badges only need an entry here.
+var Rules = []Rule{
+	{Code: "first_completion", Name: "First Step", Description: "Log your first completion", Metric: MetricEntries, Threshold: 1},
+	{Code: "streak_7", Name: "On a Roll", Description: "Reach a 7-day streak on a daily habit", Metric: MetricStreak, Threshold: 7},
+	{Code: "streak_30", Name: "Unstoppable", Description: "Reach a 30-day streak on a daily habit", Metric: MetricStreak, Threshold: 30},
+	{Code: "entries_100", Name: "Centurion", Description: "Log 100 entries", Metric: MetricEntries, Threshold: 100},
+	{Code: "perfect_week", Name: "Perfect Week", Description: "Complete every daily habit for 7 days in a row", Metric: MetricPerfectDays, Threshold: 7},
+}
+
+func (r Rule) Met(facts Facts) bool {
+	return facts[r.Metric] >= r.Threshold
+}
+
+// Gather measures every metric over the given habits. Quit habits are
+// ignored since their entries are relapses.
+func Gather(habits []stats.Input, now time.Time) Facts {
+	facts := Facts{}
+
+	var daily []stats.Input
+	for _, habit := range habits {
+		if habit.Quit {
+			continue
+		}
+
+		facts[MetricEntries] += len(habit.Entries)
+
+		if habit.Frequency == "daily" {
+			daily = append(daily, habit)
+
+			longest := stats.Compute(habit).LongestStreak
+			if longest > facts[MetricStreak] {
+				facts[MetricStreak] = longest
+			}
+		}
+	}
+
+	facts[MetricPerfectDays] = longestPerfectRun(daily, now)
+
+	return facts
+}
+
+// longestPerfectRun walks day by day from the oldest habit's creation and
+// counts the longest run where every habit that existed that day has an entry.
+func longestPerfectRun(habits []stats.Input, now time.Time) int {
+	if len(habits) == 0 {
+		return 0
+	}
+
+	first := stats.Day(habits[0].CreatedAt)
+	doneOn := make([]map[time.Time]bool, len(habits))
+	for i, habit := range habits {
+		if created := stats.Day(habit.CreatedAt); created.Before(first) {
+			first = created
+		}
+
+		doneOn[i] = make(map[time.Time]bool)
+		for _, entry := range habit.Entries {
+			doneOn[i][stats.Day(entry.At)] = true
+		}
+	}
+
+	longest, run := 0, 0
+	for day := first; !day.After(stats.Day(now)); day = day.AddDate(0, 0, 1) {
+		perfect := true
+		for i, habit := range habits {
+			if stats.Day(habit.CreatedAt).After(day) {
+				continue
+			}
+			if !doneOn[i][day] {
+				perfect = false
+				break
+			}
+		}
+
+		if perfect {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	return longest
+}
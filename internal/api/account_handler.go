@@ -0,0 +1,167 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+// AccountHandler lets users export their data and delete their account.
+// Deletion waits out gracePeriod so it can be cancelled.
+type AccountHandler struct {
+	accountStore store.AccountStore
+	gracePeriod  time.Duration
+	logger       *log.Logger
+}
+
+func NewAccountHandler(accountStore store.AccountStore, gracePeriod time.Duration, logger *log.Logger) *AccountHandler {
+	return &AccountHandler{
+		accountStore: accountStore,
+		gracePeriod:  gracePeriod,
+		logger:       logger,
+	}
+}
+
+// HandleDeleteAccount schedules the signed-in user's account for deletion.
+// Everything stays usable until the grace period ends.
+func (ah *AccountHandler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	deleteAfter, err := ah.accountStore.ScheduleDeletion(user.ID, time.Now().Add(ah.gracePeriod))
+	if err != nil {
+		ah.logger.Printf("ERROR: scheduleDeletion: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error scheduling account deletion"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{
+		"message":      "account scheduled for deletion",
+		"delete_after": deleteAfter,
+	})
+}
+
+func (ah *AccountHandler) HandleRestoreAccount(w http.ResponseWriter, r *http.Request) {
+	err := ah.accountStore.CancelDeletion(middleware.GetUser(r).ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "account is not scheduled for deletion"})
+		return
+	}
+
+	if err != nil {
+		ah.logger.Printf("ERROR: cancelDeletion: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "account deletion cancelled"})
+}
+
+// HandleExportAccount returns a zip with every dataset stored about the user,
+// each as both JSON and CSV.
+func (ah *AccountHandler) HandleExportAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	tables, err := ah.accountStore.Export(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: exportAccount: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to export account data"})
+		return
+	}
+
+	// Build the archive up front so a failure can still be reported as JSON.
+	var archive bytes.Buffer
+	err = writeExportArchive(&archive, tables)
+	if err != nil {
+		ah.logger.Printf("ERROR: writeExportArchive: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to export account data"})
+		return
+	}
+
+	filename := fmt.Sprintf("habit-tracker-export-%s-%s.zip", user.Username, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", fmt.Sprint(archive.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, err = archive.WriteTo(w)
+	if err != nil {
+		ah.logger.Printf("ERROR: writingExport: %v", err)
+	}
+}
+
+func writeExportArchive(buf *bytes.Buffer, tables []*store.ExportTable) error {
+	zw := zip.NewWriter(buf)
+
+	for _, table := range tables {
+		jsonFile, err := zw.Create(table.Name + ".json")
+		if err != nil {
+			return err
+		}
+
+		records := make([]map[string]any, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			record := make(map[string]any, len(table.Columns))
+			for i, column := range table.Columns {
+				record[column] = row[i]
+			}
+			records = append(records, record)
+		}
+
+		encoder := json.NewEncoder(jsonFile)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(records)
+		if err != nil {
+			return err
+		}
+
+		csvFile, err := zw.Create(table.Name + ".csv")
+		if err != nil {
+			return err
+		}
+
+		cw := csv.NewWriter(csvFile)
+		err = cw.Write(table.Columns)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range table.Rows {
+			fields := make([]string, len(row))
+			for i, value := range row {
+				fields[i] = csvField(value)
+			}
+
+			err = cw.Write(fields)
+			if err != nil {
+				return err
+			}
+		}
+
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func csvField(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/achievements"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+// UnlockListener is notified when a user unlocks a new achievement.
+type UnlockListener func(user *store.User, rule achievements.Rule, achievement *store.Achievement)
+
+type AchievementHandler struct {
+	achievementStore store.AchievementStore
+	habitStore       store.HabitStore
+	logger           *log.Logger
+	unlockListeners  []UnlockListener
+}
+
+func NewAchievementHandler(achievementStore store.AchievementStore, habitStore store.HabitStore, logger *log.Logger) *AchievementHandler {
+	return &AchievementHandler{
+		achievementStore: achievementStore,
+		habitStore:       habitStore,
+		logger:           logger,
+	}
+}
+
+type achievementStatus struct {
+	achievements.Rule
+	Progress   int        `json:"progress"`
+	UnlockedAt *time.Time `json:"unlocked_at"`
+}
+
+// OnUnlock registers a listener that runs once for every newly awarded badge.
+func (ah *AchievementHandler) OnUnlock(listener UnlockListener) {
+	ah.unlockListeners = append(ah.unlockListeners, listener)
+}
+
+// gatherFacts summarises the habits userID can list for the badge rules.
+func (ah *AchievementHandler) gatherFacts(userID uuid.UUID) (achievements.Facts, error) {
+	habits, err := ah.habitStore.GetHabitsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make([]stats.Input, 0, len(habits))
+	for _, habit := range habits {
+		// Group members don't earn badges for each other's entries.
+		entries, err := ah.habitStore.GetHabitEntriesByUser(habit.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		input, err := buildStatsInput(ah.habitStore, habit, entries)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+
+	return achievements.Gather(inputs, time.Now()), nil
+}
+
+// EvaluateAchievements awards any badges the user has newly earned. It is
+// registered as an entry listener on the HabitHandler.
+func (ah *AchievementHandler) EvaluateAchievements(user *store.User, _ uuid.UUID) {
+	if user.IsAnonymous() {
+		return
+	}
+
+	facts, err := ah.gatherFacts(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: gatherFacts: %v", err)
+		return
+	}
+
+	for _, rule := range achievements.Rules {
+		if !rule.Met(facts) {
+			continue
+		}
+
+		achievement, err := ah.achievementStore.AwardAchievement(user.ID, rule.Code)
+		if err != nil {
+			ah.logger.Printf("ERROR: awardAchievement: %v", err)
+			return
+		}
+
+		if achievement == nil {
+			continue
+		}
+
+		for _, listener := range ah.unlockListeners {
+			listener(user, rule, achievement)
+		}
+	}
+}
+
+func (ah *AchievementHandler) HandleGetAchievements(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	awarded, err := ah.achievementStore.GetAchievements(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: getAchievements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve achievements"})
+		return
+	}
+
+	facts, err := ah.gatherFacts(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: gatherFacts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve achievements"})
+		return
+	}
+
+	unlockedAt := make(map[string]time.Time)
+	for _, achievement := range awarded {
+		unlockedAt[achievement.Code] = achievement.UnlockedAt
+	}
+
+	statuses := make([]achievementStatus, 0, len(achievements.Rules))
+	for _, rule := range achievements.Rules {
+		status := achievementStatus{Rule: rule, Progress: min(facts[rule.Metric], rule.Threshold)}
+		if at, ok := unlockedAt[rule.Code]; ok {
+			status.UnlockedAt = &at
+			status.Progress = rule.Threshold
+		}
+		statuses = append(statuses, status)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"achievements": statuses})
+}
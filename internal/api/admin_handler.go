@@ -0,0 +1,258 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+// AdminHandler serves the /admin routes. Every route is mounted behind
+// RequireRole(store.RoleAdmin), so the handlers don't check roles themselves.
+type AdminHandler struct {
+	userStore   store.UserStore
+	tokenStore  store.TokenStore
+	apiKeyStore store.APIKeyStore
+	adminStore  store.AdminStore
+	audit       *auditor
+	logger      *log.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, tokenStore store.TokenStore, apiKeyStore store.APIKeyStore, adminStore store.AdminStore, auditStore store.AuditStore, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore:   userStore,
+		tokenStore:  tokenStore,
+		apiKeyStore: apiKeyStore,
+		adminStore:  adminStore,
+		audit:       &auditor{auditStore: auditStore, logger: logger},
+		logger:      logger,
+	}
+}
+
+func (ah *AdminHandler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := ah.userStore.GetUsers()
+	if err != nil {
+		ah.logger.Printf("ERROR: getUsers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve users"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"users": users})
+}
+
+// readTargetUser loads the {id} user, writing the error response and
+// returning nil when it can't. Admins can't act on their own account here.
+func (ah *AdminHandler) readTargetUser(w http.ResponseWriter, r *http.Request) *store.User {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return nil
+	}
+
+	if userID == middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you cannot change your own account here"})
+		return nil
+	}
+
+	user, err := ah.userStore.GetUserByID(userID)
+	if err != nil {
+		ah.logger.Printf("ERROR: getUserByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return nil
+	}
+
+	return user
+}
+
+func (ah *AdminHandler) HandleDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	ah.setDeactivated(w, r, true)
+}
+
+func (ah *AdminHandler) HandleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	ah.setDeactivated(w, r, false)
+}
+
+// setDeactivated locks or unlocks an account. Locking also signs the user
+// out everywhere.
+func (ah *AdminHandler) setDeactivated(w http.ResponseWriter, r *http.Request, deactivated bool) {
+	user := ah.readTargetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	err := ah.userStore.SetDeactivated(user.ID, deactivated)
+	if err != nil {
+		ah.logger.Printf("ERROR: setDeactivated: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if deactivated {
+		err = ah.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeAuth)
+		if err != nil {
+			ah.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	updatedUser, err := ah.userStore.GetUserByID(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: getUserByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.audit.record(r, auditUpdate, "user", user.ID, user, updatedUser)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": updatedUser})
+}
+
+func (ah *AdminHandler) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	user := ah.readTargetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var updateRoleRequest struct {
+		Role string `json:"role"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&updateRoleRequest)
+	if err != nil {
+		ah.logger.Printf("ERROR: decodingUpdateRole: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if updateRoleRequest.Role != store.RoleUser && updateRoleRequest.Role != store.RoleAdmin {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "role must be user or admin"})
+		return
+	}
+
+	err = ah.userStore.UpdateRole(user.ID, updateRoleRequest.Role)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	if err != nil {
+		ah.logger.Printf("ERROR: updateRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	before := *user
+	user.Role = updateRoleRequest.Role
+	ah.audit.record(r, auditUpdate, "user", user.ID, before, user)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleResetPassword sets a new password for a user, signs them out
+// everywhere and revokes their API keys. Without a password in the body a
+// temporary one is generated and returned once.
+func (ah *AdminHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	user := ah.readTargetUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var resetPasswordRequest struct {
+		Password string `json:"password"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&resetPasswordRequest)
+	if err != nil && err != io.EOF {
+		ah.logger.Printf("ERROR: decodingResetPassword: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	generated := resetPasswordRequest.Password == ""
+	if generated {
+		resetPasswordRequest.Password, err = generatePassword()
+		if err != nil {
+			ah.logger.Printf("ERROR: generatePassword: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	if len(resetPasswordRequest.Password) < 8 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password must be at least 8 characters"})
+		return
+	}
+
+	err = user.PasswordHash.Set(resetPasswordRequest.Password)
+	if err != nil {
+		ah.logger.Printf("ERROR: hashingPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = ah.userStore.UpdatePassword(user)
+	if err != nil {
+		ah.logger.Printf("ERROR: updatePassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = ah.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeAuth)
+	if err != nil {
+		ah.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = ah.apiKeyStore.DeleteAllAPIKeysForUser(user.ID)
+	if err != nil {
+		ah.logger.Printf("ERROR: deleteAllAPIKeysForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.audit.record(r, auditUpdate, "user_password", user.ID, nil, nil)
+
+	response := utils.Envelope{"message": "password reset successfully"}
+	if generated {
+		response["password"] = resetPasswordRequest.Password
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func generatePassword() (string, error) {
+	randomBytes := make([]byte, 12)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func (ah *AdminHandler) HandleGetUsageStats(w http.ResponseWriter, r *http.Request) {
+	usage, err := ah.adminStore.GetUsageStats()
+	if err != nil {
+		ah.logger.Printf("ERROR: getUsageStats: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute usage stats"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"stats": usage})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+// HandleCreateAPIKey issues a key with the requested scopes. The plaintext is
+// only ever returned here.
+func (kh *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var createAPIKeyRequest struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createAPIKeyRequest)
+	if err != nil {
+		kh.logger.Printf("ERROR: decodingCreateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if createAPIKeyRequest.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	if len(createAPIKeyRequest.Scopes) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "at least one scope is required"})
+		return
+	}
+
+	for _, scope := range createAPIKeyRequest.Scopes {
+		if !slices.Contains(store.APIScopes, scope) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown scope " + scope, "scopes": store.APIScopes})
+			return
+		}
+	}
+
+	if createAPIKeyRequest.ExpiresInDays < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expires_in_days must not be negative"})
+		return
+	}
+
+	key := &store.APIKey{
+		UserID: middleware.GetUser(r).ID,
+		Name:   createAPIKeyRequest.Name,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(createAPIKeyRequest.Scopes))),
+	}
+
+	if createAPIKeyRequest.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, createAPIKeyRequest.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	plaintext, err := kh.apiKeyStore.CreateAPIKey(key)
+	if err != nil {
+		kh.logger.Printf("ERROR: createAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create API key"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key, "key": plaintext})
+}
+
+func (kh *APIKeyHandler) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := kh.apiKeyStore.GetAPIKeys(middleware.GetUser(r).ID)
+	if err != nil {
+		kh.logger.Printf("ERROR: getAPIKeys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve API keys"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (kh *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := utils.ReadIDParam(r)
+	if err != nil {
+		kh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid API key id"})
+		return
+	}
+
+	err = kh.apiKeyStore.DeleteAPIKey(keyID, middleware.GetUser(r).ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "API key not found"})
+		return
+	}
+
+	if err != nil {
+		kh.logger.Printf("ERROR: deleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error revoking API key"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "API key revoked successfully"})
+}
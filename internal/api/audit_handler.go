@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+// auditor writes the audit trail for handlers that mutate resources.
+// Recording happens after the change has been committed, so a failure is
+// logged rather than turned into an error response.
+type auditor struct {
+	auditStore store.AuditStore
+	logger     *log.Logger
+}
+
+func (a *auditor) record(r *http.Request, action, resourceType string, resourceID uuid.UUID, before, after any) {
+	entry := &store.AuditEntry{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		IP:           utils.ClientIP(r),
+	}
+
+	user := middleware.GetUser(r)
+	if !user.IsAnonymous() {
+		entry.ActorID = &user.ID
+	}
+
+	var err error
+	if before != nil {
+		entry.Before, err = json.Marshal(before)
+		if err != nil {
+			a.logger.Printf("ERROR: marshalAuditBefore: %v", err)
+			return
+		}
+	}
+	if after != nil {
+		entry.After, err = json.Marshal(after)
+		if err != nil {
+			a.logger.Printf("ERROR: marshalAuditAfter: %v", err)
+			return
+		}
+	}
+
+	err = a.auditStore.RecordAudit(entry)
+	if err != nil {
+		a.logger.Printf("ERROR: recordAudit: %v", err)
+	}
+}
+
+type AuditHandler struct {
+	auditStore store.AuditStore
+	logger     *log.Logger
+}
+
+func NewAuditHandler(auditStore store.AuditStore, logger *log.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditStore: auditStore,
+		logger:     logger,
+	}
+}
+
+// HandleGetAuditLog lists audit entries, newest first. It accepts actor_id,
+// action, resource_type, resource_id, since and until (YYYY-MM-DD, until
+// inclusive) and limit query parameters.
+func (ah *AuditHandler) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		Limit:        100,
+	}
+
+	for name, target := range map[string]**uuid.UUID{"actor_id": &filter.ActorID, "resource_id": &filter.ResourceID} {
+		if value := query.Get(name); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid " + name})
+				return
+			}
+			*target = &id
+		}
+	}
+
+	if value := query.Get("since"); value != "" {
+		since, err := utils.ParseDate(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		filter.Since = &since
+	}
+
+	if value := query.Get("until"); value != "" {
+		until, err := utils.ParseDate(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		until = until.Add(24 * time.Hour)
+		filter.Until = &until
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := ah.auditStore.GetAuditEntries(filter)
+	if err != nil {
+		ah.logger.Printf("ERROR: getAuditEntries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve audit log"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"audit": entries})
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type ChallengeHandler struct {
+	challengeStore store.ChallengeStore
+	templateStore  store.TemplateStore
+	habitStore     store.HabitStore
+	logger         *log.Logger
+}
+
+func NewChallengeHandler(challengeStore store.ChallengeStore, templateStore store.TemplateStore, habitStore store.HabitStore, logger *log.Logger) *ChallengeHandler {
+	return &ChallengeHandler{
+		challengeStore: challengeStore,
+		templateStore:  templateStore,
+		habitStore:     habitStore,
+		logger:         logger,
+	}
+}
+
+func (ch *ChallengeHandler) HandleCreateChallenge(w http.ResponseWriter, r *http.Request) {
+	var createChallengeRequest struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		TemplateID  string `json:"template_id"`
+		StartDate   string `json:"start_date"`
+		EndDate     string `json:"end_date"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createChallengeRequest)
+	if err != nil {
+		ch.logger.Printf("ERROR: decodingCreateChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if createChallengeRequest.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	startDate, err := utils.ParseDate(createChallengeRequest.StartDate)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	endDate, err := utils.ParseDate(createChallengeRequest.EndDate)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if endDate.Before(startDate) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "end_date must not be before start_date"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+
+	template, err := ch.templateStore.GetTemplateByID(user.ID, createChallengeRequest.TemplateID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getTemplateByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if template == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "template not found"})
+		return
+	}
+
+	challenge, err := ch.challengeStore.CreateChallenge(&store.Challenge{
+		Name:        createChallengeRequest.Name,
+		Description: createChallengeRequest.Description,
+		TemplateID:  template.ID,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		CreatedBy:   user.ID,
+	})
+	if err != nil {
+		ch.logger.Printf("ERROR: createChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create challenge"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"challenge": challenge})
+}
+
+func (ch *ChallengeHandler) HandleGetChallenges(w http.ResponseWriter, r *http.Request) {
+	challenges, err := ch.challengeStore.GetChallenges()
+	if err != nil {
+		ch.logger.Printf("ERROR: getChallenges: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve challenges"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"challenges": challenges})
+}
+
+func (ch *ChallengeHandler) HandleGetChallengeByID(w http.ResponseWriter, r *http.Request) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge id"})
+		return
+	}
+
+	challenge, err := ch.challengeStore.GetChallengeByID(challengeID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getChallengeByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if challenge == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge not found"})
+		return
+	}
+
+	participants, err := ch.challengeStore.GetParticipants(challengeID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getParticipants: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"challenge": challenge, "participants": participants})
+}
+
+func (ch *ChallengeHandler) HandleDeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge id"})
+		return
+	}
+
+	err = ch.challengeStore.DeleteChallenge(challengeID, middleware.GetUser(r).ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "challenge not found"})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting challenge"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "challenge deleted successfully"})
+}
+
+// HandleJoinChallenge signs the caller up and creates their habit from the
+// challenge's template. Challenges can be joined until they end.
+func (ch *ChallengeHandler) HandleJoinChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge id"})
+		return
+	}
+
+	challenge, err := ch.challengeStore.GetChallengeByID(challengeID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getChallengeByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if challenge == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge not found"})
+		return
+	}
+
+	if stats.Day(time.Now()).After(challenge.EndDate) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "challenge has ended"})
+		return
+	}
+
+	// The template is resolved as the creator, so challenges can be built on
+	// their private templates too.
+	template, err := ch.templateStore.GetTemplateByID(challenge.CreatedBy, challenge.TemplateID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getTemplateByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if template == nil {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "challenge template no longer exists"})
+		return
+	}
+
+	participant, habit, err := ch.challengeStore.JoinChallenge(challengeID, middleware.GetUser(r).ID, template)
+	if err != nil {
+		ch.logger.Printf("ERROR: joinChallenge: %v", err)
+
+		if err.Error() == "already joined this challenge" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to join challenge"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"participant": participant, "habit": habit})
+}
+
+type leaderboardItem struct {
+	Rank             int       `json:"rank"`
+	UserID           uuid.UUID `json:"user_id"`
+	Username         string    `json:"username"`
+	HabitID          uuid.UUID `json:"habit_id"`
+	CompletionRate   float64   `json:"completion_rate"`
+	TotalValue       float64   `json:"total_value"`
+	TotalCompletions int       `json:"total_completions"`
+}
+
+// HandleGetLeaderboard ranks participants by completion_rate (the default)
+// or total_value, counting only entries logged within the challenge dates.
+func (ch *ChallengeHandler) HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	challengeID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge id"})
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "completion_rate"
+	}
+	if by != "completion_rate" && by != "total_value" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "by must be completion_rate or total_value"})
+		return
+	}
+
+	challenge, err := ch.challengeStore.GetChallengeByID(challengeID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getChallengeByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if challenge == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge not found"})
+		return
+	}
+
+	participants, err := ch.challengeStore.GetParticipants(challengeID)
+	if err != nil {
+		ch.logger.Printf("ERROR: getParticipants: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute leaderboard"})
+		return
+	}
+
+	leaderboard := []leaderboardItem{}
+	for _, participant := range participants {
+		item := leaderboardItem{
+			UserID:   participant.UserID,
+			Username: participant.Username,
+			HabitID:  participant.HabitID,
+		}
+
+		habit, err := ch.habitStore.GetHabitByID(participant.HabitID)
+		if err != nil {
+			ch.logger.Printf("ERROR: getHabitByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute leaderboard"})
+			return
+		}
+
+		if habit != nil {
+			input, err := loadStatsInput(ch.habitStore, habit)
+			if err != nil {
+				ch.logger.Printf("ERROR: loadStatsInput: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute leaderboard"})
+				return
+			}
+
+			if input, ok := challengeWindow(input, challenge); ok {
+				summary := stats.Compute(input)
+				item.CompletionRate = summary.CompletionRate
+				item.TotalValue = summary.TotalValue
+				item.TotalCompletions = summary.TotalCompletions
+			}
+		}
+
+		leaderboard = append(leaderboard, item)
+	}
+
+	score := func(item leaderboardItem) float64 {
+		if by == "total_value" {
+			return item.TotalValue
+		}
+		return item.CompletionRate
+	}
+
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		if score(leaderboard[i]) != score(leaderboard[j]) {
+			return score(leaderboard[i]) > score(leaderboard[j])
+		}
+		return leaderboard[i].Username < leaderboard[j].Username
+	})
+
+	for i := range leaderboard {
+		leaderboard[i].Rank = i + 1
+		if i > 0 && score(leaderboard[i]) == score(leaderboard[i-1]) {
+			leaderboard[i].Rank = leaderboard[i-1].Rank
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"challenge": challenge, "by": by, "leaderboard": leaderboard})
+}
+
+// challengeWindow narrows a habit's stats input to the challenge dates. It
+// reports false before the challenge has started.
+func challengeWindow(input stats.Input, challenge *store.Challenge) (stats.Input, bool) {
+	start := stats.Day(challenge.StartDate)
+	end := stats.Day(challenge.EndDate).AddDate(0, 0, 1)
+
+	if input.Now.Before(start) {
+		return input, false
+	}
+	if !input.Now.Before(end) {
+		input.Now = end.Add(-time.Nanosecond)
+	}
+	input.CreatedAt = start
+
+	entries := []stats.Entry{}
+	for _, entry := range input.Entries {
+		if !entry.At.Before(start) && entry.At.Before(end) {
+			entries = append(entries, entry)
+		}
+	}
+	input.Entries = entries
+
+	return input, true
+}
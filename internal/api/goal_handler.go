@@ -0,0 +1,418 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const (
+	goalStatusActive   = "active"
+	goalStatusAchieved = "achieved"
+	goalStatusMissed   = "missed"
+)
+
+type GoalHandler struct {
+	goalStore  store.GoalStore
+	habitStore store.HabitStore
+	logger     *log.Logger
+}
+
+func NewGoalHandler(goalStore store.GoalStore, habitStore store.HabitStore, logger *log.Logger) *GoalHandler {
+	return &GoalHandler{
+		goalStore:  goalStore,
+		habitStore: habitStore,
+		logger:     logger,
+	}
+}
+
+type goalProgress struct {
+	Goal     *store.Goal `json:"goal"`
+	Progress float64     `json:"progress"`
+	Status   string      `json:"status"`
+}
+
+func validGoalKind(kind string) bool {
+	return kind == store.GoalKindTotal || kind == store.GoalKindValue || kind == store.GoalKindStreak
+}
+
+// evaluateGoal measures a goal against the habit's entries. The first time a
+// goal is found to be reached a milestone is recorded, dated by the entry that
+// crossed the target (or now, for streak goals).
+func (gh *GoalHandler) evaluateGoal(goal *store.Goal, input stats.Input) (*goalProgress, error) {
+	result := &goalProgress{Goal: goal}
+
+	var reachedAt time.Time
+	switch goal.Kind {
+	case store.GoalKindStreak:
+		// Only the part of the streak since the goal was set counts towards it.
+		since := stats.PeriodStart(goal.CreatedAt, input.Frequency)
+		sinceGoal := input
+		sinceGoal.CreatedAt = goal.CreatedAt
+		sinceGoal.Entries = nil
+		for _, entry := range input.Entries {
+			if !stats.PeriodStart(entry.At, input.Frequency).Before(since) {
+				sinceGoal.Entries = append(sinceGoal.Entries, entry)
+			}
+		}
+
+		result.Progress = float64(stats.Compute(sinceGoal).CurrentStreak)
+		pastDeadline := goal.Deadline != nil && stats.Day(input.Now).After(stats.Day(*goal.Deadline))
+		if result.Progress >= goal.Target && !pastDeadline {
+			reachedAt = input.Now
+		}
+	default:
+		for _, entry := range input.Entries {
+			if entry.At.Before(goal.CreatedAt) {
+				continue
+			}
+			if goal.Deadline != nil && stats.Day(entry.At).After(stats.Day(*goal.Deadline)) {
+				break
+			}
+
+			if goal.Kind == store.GoalKindValue {
+				result.Progress += entry.Value
+			} else {
+				result.Progress++
+			}
+
+			if reachedAt.IsZero() && result.Progress >= goal.Target {
+				reachedAt = entry.At
+			}
+		}
+	}
+
+	if goal.Milestone == nil && !reachedAt.IsZero() {
+		milestone, err := gh.goalStore.RecordMilestone(goal.ID, reachedAt)
+		if err != nil {
+			return nil, err
+		}
+		goal.Milestone = milestone
+	}
+
+	switch {
+	case goal.Milestone != nil:
+		result.Status = goalStatusAchieved
+	case goal.Deadline != nil && stats.Day(input.Now).After(stats.Day(*goal.Deadline)):
+		result.Status = goalStatusMissed
+	default:
+		result.Status = goalStatusActive
+	}
+
+	return result, nil
+}
+
+// evaluateGoals evaluates goals that may belong to different habits, loading
+// each habit's entries only once.
+func (gh *GoalHandler) evaluateGoals(goals []*store.Goal) ([]*goalProgress, error) {
+	inputs := make(map[uuid.UUID]stats.Input)
+	results := []*goalProgress{}
+
+	for _, goal := range goals {
+		input, ok := inputs[goal.HabitID]
+		if !ok {
+			habit, err := gh.habitStore.GetHabitByID(goal.HabitID)
+			if err != nil {
+				return nil, err
+			}
+			if habit == nil {
+				continue
+			}
+
+			input, err = loadStatsInput(gh.habitStore, habit)
+			if err != nil {
+				return nil, err
+			}
+			inputs[goal.HabitID] = input
+		}
+
+		result, err := gh.evaluateGoal(goal, input)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// EvaluateHabitGoals records milestones for any goals of a habit that have just
+// been reached. It is registered as an entry listener on the HabitHandler.
+func (gh *GoalHandler) EvaluateHabitGoals(_ *store.User, habitID uuid.UUID) {
+	goals, err := gh.goalStore.GetGoalsForHabit(habitID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoalsForHabit: %v", err)
+		return
+	}
+
+	_, err = gh.evaluateGoals(goals)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %v", err)
+	}
+}
+
+func (gh *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var createGoalRequest struct {
+		Kind     string  `json:"kind"`
+		Target   float64 `json:"target"`
+		Deadline *string `json:"deadline"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&createGoalRequest)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingCreateGoal: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if !validGoalKind(createGoalRequest.Kind) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be total, value or streak"})
+		return
+	}
+
+	if createGoalRequest.Target <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target must be positive"})
+		return
+	}
+
+	goal := &store.Goal{HabitID: habitID, Kind: createGoalRequest.Kind, Target: createGoalRequest.Target}
+
+	if createGoalRequest.Deadline != nil {
+		deadline, err := utils.ParseDate(*createGoalRequest.Deadline)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		goal.Deadline = &deadline
+	}
+
+	habit, err := gh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if habit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	createdGoal, err := gh.goalStore.CreateGoal(goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: createGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create goal"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"goal": createdGoal})
+}
+
+func (gh *GoalHandler) HandleGetHabitGoals(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	goals, err := gh.goalStore.GetGoalsForHabit(habitID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoalsForHabit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve goals"})
+		return
+	}
+
+	results, err := gh.evaluateGoals(goals)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve goals"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goals": results})
+}
+
+func (gh *GoalHandler) HandleGetGoalByID(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	goalID, err := utils.ReadUUIDParam(r, "goalID")
+	if err != nil {
+		gh.logger.Printf("ERROR: readGoalIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal id"})
+		return
+	}
+
+	goal, err := gh.goalStore.GetGoalByID(habitID, goalID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoalByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if goal == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal not found"})
+		return
+	}
+
+	results, err := gh.evaluateGoals([]*store.Goal{goal})
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if len(results) == 0 {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goal": results[0]})
+}
+
+func (gh *GoalHandler) HandleUpdateGoalByID(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	goalID, err := utils.ReadUUIDParam(r, "goalID")
+	if err != nil {
+		gh.logger.Printf("ERROR: readGoalIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal id"})
+		return
+	}
+
+	existingGoal, err := gh.goalStore.GetGoalByID(habitID, goalID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoalByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingGoal == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal not found"})
+		return
+	}
+
+	var updateGoalRequest struct {
+		Kind     *string  `json:"kind"`
+		Target   *float64 `json:"target"`
+		Deadline *string  `json:"deadline"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&updateGoalRequest)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingUpdateRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if updateGoalRequest.Kind != nil {
+		if !validGoalKind(*updateGoalRequest.Kind) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "kind must be total, value or streak"})
+			return
+		}
+		existingGoal.Kind = *updateGoalRequest.Kind
+	}
+	if updateGoalRequest.Target != nil {
+		if *updateGoalRequest.Target <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "target must be positive"})
+			return
+		}
+		existingGoal.Target = *updateGoalRequest.Target
+	}
+	if updateGoalRequest.Deadline != nil {
+		// An empty deadline removes it.
+		if *updateGoalRequest.Deadline == "" {
+			existingGoal.Deadline = nil
+		} else {
+			deadline, err := utils.ParseDate(*updateGoalRequest.Deadline)
+			if err != nil {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+				return
+			}
+			existingGoal.Deadline = &deadline
+		}
+	}
+
+	err = gh.goalStore.UpdateGoal(existingGoal)
+	if err != nil {
+		gh.logger.Printf("ERROR: updatingGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goal": existingGoal})
+}
+
+func (gh *GoalHandler) HandleDeleteGoalByID(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	goalID, err := utils.ReadUUIDParam(r, "goalID")
+	if err != nil {
+		gh.logger.Printf("ERROR: readGoalIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal id"})
+		return
+	}
+
+	err = gh.goalStore.DeleteGoal(habitID, goalID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "goal not found"})
+		return
+	}
+
+	if err != nil {
+		gh.logger.Printf("ERROR: deleteGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting goal"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "goal deleted successfully"})
+}
+
+// HandleGetGoals is the overview of every goal across the caller's habits.
+func (gh *GoalHandler) HandleGetGoals(w http.ResponseWriter, r *http.Request) {
+	goals, err := gh.goalStore.GetGoalsForUser(middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGoals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve goals"})
+		return
+	}
+
+	results, err := gh.evaluateGoals(goals)
+	if err != nil {
+		gh.logger.Printf("ERROR: evaluateGoals: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve goals"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goals": results})
+}
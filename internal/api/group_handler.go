@@ -0,0 +1,357 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type GroupHandler struct {
+	groupStore store.GroupStore
+	habitStore store.HabitStore
+	userStore  store.UserStore
+	audit      *auditor
+	logger     *log.Logger
+}
+
+func NewGroupHandler(groupStore store.GroupStore, habitStore store.HabitStore, userStore store.UserStore, auditStore store.AuditStore, logger *log.Logger) *GroupHandler {
+	return &GroupHandler{
+		groupStore: groupStore,
+		habitStore: habitStore,
+		userStore:  userStore,
+		audit:      &auditor{auditStore: auditStore, logger: logger},
+		logger:     logger,
+	}
+}
+
+// groupRank orders roles so a check can ask for "at least admin".
+var groupRank = map[string]int{
+	store.GroupRoleMember: 1,
+	store.GroupRoleAdmin:  2,
+	store.GroupRoleOwner:  3,
+}
+
+// authorizeGroup reads the {id} group and checks the caller holds at least
+// minRole in it. It writes the error response and returns false otherwise;
+// groups the caller isn't in are reported as not found.
+func (gh *GroupHandler) authorizeGroup(w http.ResponseWriter, r *http.Request, minRole string) (uuid.UUID, string, bool) {
+	groupID, err := utils.ReadIDParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid group id"})
+		return uuid.Nil, "", false
+	}
+
+	role, err := gh.groupStore.GetMemberRole(groupID, middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getMemberRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return uuid.Nil, "", false
+	}
+
+	if role == "" {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "group not found"})
+		return uuid.Nil, "", false
+	}
+
+	if groupRank[role] < groupRank[minRole] {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your role in this group does not allow this"})
+		return uuid.Nil, "", false
+	}
+
+	return groupID, role, true
+}
+
+func (gh *GroupHandler) HandleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var createGroupRequest struct {
+		Name string `json:"name"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createGroupRequest)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingCreateGroup: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if createGroupRequest.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	group, err := gh.groupStore.CreateGroup(&store.Group{
+		Name:      createGroupRequest.Name,
+		CreatedBy: middleware.GetUser(r).ID,
+	})
+	if err != nil {
+		gh.logger.Printf("ERROR: createGroup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create group"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"group": group})
+}
+
+func (gh *GroupHandler) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := gh.groupStore.GetGroupsForUser(middleware.GetUser(r).ID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGroupsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve groups"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"groups": groups})
+}
+
+func (gh *GroupHandler) HandleGetGroupByID(w http.ResponseWriter, r *http.Request) {
+	groupID, _, ok := gh.authorizeGroup(w, r, store.GroupRoleMember)
+	if !ok {
+		return
+	}
+
+	group, err := gh.groupStore.GetGroupByID(groupID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGroupByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	members, err := gh.groupStore.GetMembers(groupID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getMembers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"group": group, "members": members})
+}
+
+func (gh *GroupHandler) HandleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, _, ok := gh.authorizeGroup(w, r, store.GroupRoleOwner)
+	if !ok {
+		return
+	}
+
+	err := gh.groupStore.DeleteGroup(groupID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "group not found"})
+		return
+	}
+
+	if err != nil {
+		gh.logger.Printf("ERROR: deleteGroup: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting group"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "group deleted successfully"})
+}
+
+// HandleAddGroupMember adds a user by username. Admins can add members; only
+// the owner can add further admins.
+func (gh *GroupHandler) HandleAddGroupMember(w http.ResponseWriter, r *http.Request) {
+	groupID, callerRole, ok := gh.authorizeGroup(w, r, store.GroupRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var addMemberRequest struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&addMemberRequest)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingAddGroupMember: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if addMemberRequest.Role == "" {
+		addMemberRequest.Role = store.GroupRoleMember
+	}
+	if addMemberRequest.Role != store.GroupRoleMember && addMemberRequest.Role != store.GroupRoleAdmin {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "role must be member or admin"})
+		return
+	}
+	if addMemberRequest.Role == store.GroupRoleAdmin && callerRole != store.GroupRoleOwner {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the group owner can add admins"})
+		return
+	}
+
+	user, err := gh.userStore.GetUserByUsername(addMemberRequest.Username)
+	if err != nil {
+		gh.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	member, err := gh.groupStore.AddMember(groupID, user.ID, addMemberRequest.Role)
+	if err != nil {
+		gh.logger.Printf("ERROR: addMember: %v", err)
+
+		if err.Error() == "user is already a member of this group" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to add member"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"member": member})
+}
+
+// HandleUpdateGroupMember changes a member's role. Only the owner can do
+// this, and the owner's own role is fixed.
+func (gh *GroupHandler) HandleUpdateGroupMember(w http.ResponseWriter, r *http.Request) {
+	groupID, _, ok := gh.authorizeGroup(w, r, store.GroupRoleOwner)
+	if !ok {
+		return
+	}
+
+	userID, err := utils.ReadUUIDParam(r, "userID")
+	if err != nil {
+		gh.logger.Printf("ERROR: readUUIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	var updateMemberRequest struct {
+		Role string `json:"role"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&updateMemberRequest)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingUpdateGroupMember: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if updateMemberRequest.Role != store.GroupRoleMember && updateMemberRequest.Role != store.GroupRoleAdmin {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "role must be member or admin"})
+		return
+	}
+
+	err = gh.groupStore.UpdateMemberRole(groupID, userID, updateMemberRequest.Role)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member not found"})
+		return
+	}
+
+	if err != nil {
+		gh.logger.Printf("ERROR: updateMemberRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "member updated successfully"})
+}
+
+// HandleRemoveGroupMember removes a member. Members may remove themselves;
+// removing anyone else takes an admin, and only the owner can remove admins.
+func (gh *GroupHandler) HandleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	groupID, callerRole, ok := gh.authorizeGroup(w, r, store.GroupRoleMember)
+	if !ok {
+		return
+	}
+
+	userID, err := utils.ReadUUIDParam(r, "userID")
+	if err != nil {
+		gh.logger.Printf("ERROR: readUUIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	if userID != middleware.GetUser(r).ID {
+		targetRole, err := gh.groupStore.GetMemberRole(groupID, userID)
+		if err != nil {
+			gh.logger.Printf("ERROR: getMemberRole: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if groupRank[callerRole] < groupRank[store.GroupRoleAdmin] || groupRank[targetRole] >= groupRank[callerRole] {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your role in this group does not allow this"})
+			return
+		}
+	}
+
+	err = gh.groupStore.RemoveMember(groupID, userID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "member not found"})
+		return
+	}
+
+	if err != nil {
+		gh.logger.Printf("ERROR: removeMember: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error removing member"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "member removed successfully"})
+}
+
+func (gh *GroupHandler) HandleGetGroupHabits(w http.ResponseWriter, r *http.Request) {
+	groupID, _, ok := gh.authorizeGroup(w, r, store.GroupRoleMember)
+	if !ok {
+		return
+	}
+
+	habits, err := gh.habitStore.GetGroupHabits(groupID)
+	if err != nil {
+		gh.logger.Printf("ERROR: getGroupHabits: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habits"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habits": habits})
+}
+
+// HandleCreateGroupHabit creates a habit owned by the group. Its target is
+// shared: every member's entries count towards it.
+func (gh *GroupHandler) HandleCreateGroupHabit(w http.ResponseWriter, r *http.Request) {
+	groupID, _, ok := gh.authorizeGroup(w, r, store.GroupRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var habit store.Habit
+
+	err := json.NewDecoder(r.Body).Decode(&habit)
+	if err != nil {
+		gh.logger.Printf("ERROR: decodingCreateGroupHabit: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if habit.Polarity != "" && habit.Polarity != store.PolarityBuild && habit.Polarity != store.PolarityQuit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "polarity must be build or quit"})
+		return
+	}
+
+	habit.UserID = nil
+	habit.GroupID = &groupID
+
+	createdHabit, err := gh.habitStore.CreateHabit(&habit)
+	if err != nil {
+		gh.logger.Printf("ERROR: createHabit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create habit"})
+		return
+	}
+
+	gh.audit.record(r, auditCreate, "habit", createdHabit.ID, nil, createdHabit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habit": createdHabit})
+}
@@ -3,26 +3,201 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
 	"github.com/kevin120202/habit-tracker/internal/store"
 	"github.com/kevin120202/habit-tracker/internal/utils"
 )
 
+// EntryListener is notified after an entry has been logged for a habit by
+// the given user, who may be anonymous.
+type EntryListener func(user *store.User, habitID uuid.UUID)
+
 type HabitHandler struct {
-	habitStore store.HabitStore
-	logger     *log.Logger
+	habitStore     store.HabitStore
+	partnerStore   store.PartnerStore
+	audit          *auditor
+	logger         *log.Logger
+	entryListeners []EntryListener
 }
 
-func NewHabitHandler(habitStore store.HabitStore, logger *log.Logger) *HabitHandler {
+func NewHabitHandler(habitStore store.HabitStore, partnerStore store.PartnerStore, auditStore store.AuditStore, logger *log.Logger) *HabitHandler {
 	return &HabitHandler{
-		habitStore: habitStore,
-		logger:     logger,
+		habitStore:   habitStore,
+		partnerStore: partnerStore,
+		audit:        &auditor{auditStore: auditStore, logger: logger},
+		logger:       logger,
+	}
+}
+
+// habitAccess is what a user may do with a habit.
+type habitAccess int
+
+const (
+	accessNone habitAccess = iota
+	accessRead
+	accessLog
+	accessOwner
+)
+
+// accessTo resolves the user's access to a habit. Ownerless habits are open
+// to everyone; group habits can be logged by any member and managed by the
+// group's owner and admins; partners may only read.
+func (hh *HabitHandler) accessTo(user *store.User, habit *store.Habit) (habitAccess, error) {
+	if habit.UserID == nil && habit.GroupID == nil {
+		return accessOwner, nil
+	}
+
+	if user.IsAnonymous() {
+		return accessNone, nil
+	}
+
+	if habit.UserID != nil && *habit.UserID == user.ID {
+		return accessOwner, nil
+	}
+
+	if habit.GroupID != nil {
+		role, err := hh.habitStore.GetHabitGroupRole(habit.ID, user.ID)
+		if err != nil {
+			return accessNone, err
+		}
+
+		switch role {
+		case store.GroupRoleOwner, store.GroupRoleAdmin:
+			return accessOwner, nil
+		case store.GroupRoleMember:
+			return accessLog, nil
+		}
+	}
+
+	isPartner, err := hh.partnerStore.IsPartner(habit.ID, user.ID)
+	if err != nil {
+		return accessNone, err
+	}
+
+	if isPartner {
+		return accessRead, nil
+	}
+
+	return accessNone, nil
+}
+
+// canRead reports whether user may at least read the habit with the given
+// id. A habit that doesn't exist can't be read.
+func (hh *HabitHandler) canRead(user *store.User, habitID uuid.UUID) (bool, error) {
+	habit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil || habit == nil {
+		return false, err
+	}
+
+	access, err := hh.accessTo(user, habit)
+	if err != nil {
+		return false, err
+	}
+
+	return access >= accessRead, nil
+}
+
+// RequireHabitOwner guards a /habits/{id} route so only the habit's owner
+// gets through.
+func (hh *HabitHandler) RequireHabitOwner(next http.HandlerFunc) http.HandlerFunc {
+	return hh.requireHabitAccess(accessOwner, next)
+}
+
+// RequireHabitLogger guards a /habits/{id} route so only users who may log
+// entries get through: the owner and, for group habits, every member.
+func (hh *HabitHandler) RequireHabitLogger(next http.HandlerFunc) http.HandlerFunc {
+	return hh.requireHabitAccess(accessLog, next)
+}
+
+// RequireHabitViewer guards a /habits/{id} route so the owner and accepted
+// partners get through.
+func (hh *HabitHandler) RequireHabitViewer(next http.HandlerFunc) http.HandlerFunc {
+	return hh.requireHabitAccess(accessRead, next)
+}
+
+// requireHabitAccess leaves malformed ids and missing habits to the wrapped
+// handler. Habits the user may not see at all are reported as not found.
+// Trashed habits are checked too, so only their owner can restore them.
+func (hh *HabitHandler) requireHabitAccess(level habitAccess, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		habitID, err := utils.ReadIDParam(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		habit, err := hh.habitStore.GetHabitIncludingTrashed(habitID)
+		if err != nil {
+			hh.logger.Printf("ERROR: getHabitIncludingTrashed: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if habit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		access, err := hh.accessTo(middleware.GetUser(r), habit)
+		if err != nil {
+			hh.logger.Printf("ERROR: accessTo: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if access == accessNone {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+			return
+		}
+
+		if access < level {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you have read-only access to this habit"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// snapshotHabit reads a habit for the audit trail. A habit that can't be read
+// is recorded as missing rather than failing the request.
+func (hh *HabitHandler) snapshotHabit(habitID uuid.UUID) *store.Habit {
+	habit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		return nil
+	}
+	return habit
+}
+
+// OnEntryLogged registers a listener that runs after every successful log,
+// completion or timer stop.
+func (hh *HabitHandler) OnEntryLogged(listener EntryListener) {
+	hh.entryListeners = append(hh.entryListeners, listener)
+}
+
+func (hh *HabitHandler) notifyEntryLogged(r *http.Request, habitID uuid.UUID) {
+	user := middleware.GetUser(r)
+	for _, listener := range hh.entryListeners {
+		listener(user, habitID)
 	}
 }
 
+// entryLogged audits a newly stored entry and tells the entry listeners
+// about it. Every path that creates entries for a request goes through here.
+func (hh *HabitHandler) entryLogged(r *http.Request, entry *store.HabitEntry) {
+	hh.audit.record(r, auditCreate, "habit_entry", entry.ID, nil, entry)
+	hh.notifyEntryLogged(r, entry.HabitID)
+}
+
 func (hh *HabitHandler) HandleCreateHabit(w http.ResponseWriter, r *http.Request) {
 	var habit store.Habit
 
@@ -33,6 +208,17 @@ func (hh *HabitHandler) HandleCreateHabit(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if habit.Polarity != "" && habit.Polarity != store.PolarityBuild && habit.Polarity != store.PolarityQuit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "polarity must be build or quit"})
+		return
+	}
+
+	habit.UserID = nil
+	habit.GroupID = nil
+	if user := middleware.GetUser(r); !user.IsAnonymous() {
+		habit.UserID = &user.ID
+	}
+
 	createdHabit, err := hh.habitStore.CreateHabit(&habit)
 	if err != nil {
 		hh.logger.Printf("ERROR: createHabit: %v", err)
@@ -40,6 +226,8 @@ func (hh *HabitHandler) HandleCreateHabit(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	hh.audit.record(r, auditCreate, "habit", createdHabit.ID, nil, createdHabit)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habit": createdHabit})
 }
 
@@ -61,7 +249,15 @@ func (hh *HabitHandler) HandleGetHabitByID(w http.ResponseWriter, r *http.Reques
 }
 
 func (hh *HabitHandler) HandleGetHabits(w http.ResponseWriter, r *http.Request) {
-	habits, err := hh.habitStore.GetHabits()
+	var habits []*store.Habit
+	var err error
+
+	userID := middleware.GetUser(r).ID
+	if r.URL.Query().Get("archived") == "true" {
+		habits, err = hh.habitStore.GetArchivedHabitsForUser(userID)
+	} else {
+		habits, err = hh.habitStore.GetHabitsForUser(userID)
+	}
 	if err != nil {
 		hh.logger.Printf("ERROR: getHabits: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habits"})
@@ -91,12 +287,19 @@ func (hh *HabitHandler) HandleUpdateHabitByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	before := *existingHabit
+
 	var updateHabitRequest struct {
-		Name        *string `json:"name"`
-		Description *string `json:"description"`
-		Frequency   *string `json:"frequency"`
-		TargetCount *int    `json:"target_count"`
-		IsActive    *bool   `json:"is_active"`
+		Name            *string  `json:"name"`
+		Description     *string  `json:"description"`
+		Frequency       *string  `json:"frequency"`
+		TargetCount     *int     `json:"target_count"`
+		Unit            *string  `json:"unit"`
+		TargetAmount    *float64 `json:"target_amount"`
+		TargetDuration  *int     `json:"target_duration_seconds"`
+		Polarity        *string  `json:"polarity"`
+		IsActive        *bool    `json:"is_active"`
+		FreezesPerMonth *int     `json:"freezes_per_month"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updateHabitRequest)
@@ -118,9 +321,41 @@ func (hh *HabitHandler) HandleUpdateHabitByID(w http.ResponseWriter, r *http.Req
 	if updateHabitRequest.TargetCount != nil {
 		existingHabit.TargetCount = *updateHabitRequest.TargetCount
 	}
+	if updateHabitRequest.Unit != nil {
+		existingHabit.Unit = *updateHabitRequest.Unit
+	}
+	if updateHabitRequest.TargetAmount != nil {
+		// A zero target turns a quantitative habit back into a count-based one.
+		if *updateHabitRequest.TargetAmount > 0 {
+			existingHabit.TargetAmount = updateHabitRequest.TargetAmount
+		} else {
+			existingHabit.TargetAmount = nil
+		}
+	}
+	if updateHabitRequest.TargetDuration != nil {
+		if *updateHabitRequest.TargetDuration > 0 {
+			existingHabit.TargetDurationSeconds = updateHabitRequest.TargetDuration
+		} else {
+			existingHabit.TargetDurationSeconds = nil
+		}
+	}
+	if updateHabitRequest.Polarity != nil {
+		if *updateHabitRequest.Polarity != store.PolarityBuild && *updateHabitRequest.Polarity != store.PolarityQuit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "polarity must be build or quit"})
+			return
+		}
+		existingHabit.Polarity = *updateHabitRequest.Polarity
+	}
 	if updateHabitRequest.IsActive != nil {
 		existingHabit.IsActive = *updateHabitRequest.IsActive
 	}
+	if updateHabitRequest.FreezesPerMonth != nil {
+		if *updateHabitRequest.FreezesPerMonth < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "freezes_per_month must not be negative"})
+			return
+		}
+		existingHabit.FreezesPerMonth = *updateHabitRequest.FreezesPerMonth
+	}
 
 	err = hh.habitStore.UpdateHabit(existingHabit)
 	if err != nil {
@@ -129,6 +364,8 @@ func (hh *HabitHandler) HandleUpdateHabitByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	hh.audit.record(r, auditUpdate, "habit", habitID, &before, existingHabit)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habit": existingHabit})
 }
 
@@ -139,6 +376,8 @@ func (hh *HabitHandler) HandleDeleteHabitByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	before := hh.snapshotHabit(habitID)
+
 	err = hh.habitStore.DeleteHabit(habitID)
 	if err == sql.ErrNoRows {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "habit not found"})
@@ -150,9 +389,106 @@ func (hh *HabitHandler) HandleDeleteHabitByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	hh.audit.record(r, auditDelete, "habit", habitID, before, nil)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "habit deleted successfully"})
 }
 
+func (hh *HabitHandler) HandleRestoreHabitByID(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	err = hh.habitStore.RestoreHabit(habitID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found in trash"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: restoreHabit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error restoring habit"})
+		return
+	}
+
+	habit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	hh.audit.record(r, auditUpdate, "habit", habitID, nil, habit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habit": habit})
+}
+
+func (hh *HabitHandler) HandleArchiveHabit(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	before := hh.snapshotHabit(habitID)
+
+	err = hh.habitStore.ArchiveHabit(habitID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found or already archived"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: archiveHabit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error archiving habit"})
+		return
+	}
+
+	hh.audit.record(r, auditUpdate, "habit", habitID, before, hh.snapshotHabit(habitID))
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "habit archived successfully"})
+}
+
+func (hh *HabitHandler) HandleUnarchiveHabit(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	before := hh.snapshotHabit(habitID)
+
+	err = hh.habitStore.UnarchiveHabit(habitID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "archived habit not found"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: unarchiveHabit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error unarchiving habit"})
+		return
+	}
+
+	hh.audit.record(r, auditUpdate, "habit", habitID, before, hh.snapshotHabit(habitID))
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "habit unarchived successfully"})
+}
+
+// completedBy is who an entry logged by this request should be credited to.
+func completedBy(r *http.Request) *uuid.UUID {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		return nil
+	}
+	return &user.ID
+}
+
 func (hh *HabitHandler) HandleLogHabitCompletions(w http.ResponseWriter, r *http.Request) {
 	habitID, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -160,8 +496,26 @@ func (hh *HabitHandler) HandleLogHabitCompletions(w http.ResponseWriter, r *http
 		return
 	}
 
+	existingHabit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingHabit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	if existingHabit.ArchivedAt != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot log an archived habit"})
+		return
+	}
+
+	// An entry sent without a value is a plain completion.
 	var habitEntry store.HabitEntry
-	habitEntry.HabitID = habitID
+	habitEntry.Value = 1
 
 	err = json.NewDecoder(r.Body).Decode(&habitEntry)
 	if err != nil {
@@ -170,7 +524,21 @@ func (hh *HabitHandler) HandleLogHabitCompletions(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Verify habit belongs to user
+	// Access was checked against the habit in the path, so the body can't
+	// point the entry at another one.
+	habitEntry.HabitID = habitID
+
+	if habitEntry.Value <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "value must be greater than zero"})
+		return
+	}
+
+	if habitEntry.DurationSeconds < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "duration_seconds cannot be negative"})
+		return
+	}
+
+	habitEntry.CompletedBy = completedBy(r)
 
 	createdHabitEntry, err := hh.habitStore.LogHabit(&habitEntry)
 	if err != nil {
@@ -179,6 +547,8 @@ func (hh *HabitHandler) HandleLogHabitCompletions(w http.ResponseWriter, r *http
 		return
 	}
 
+	hh.entryLogged(r, createdHabitEntry)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habitEntry": createdHabitEntry})
 }
 
@@ -201,13 +571,23 @@ func (hh *HabitHandler) HandleCompleteHabit(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if existingHabit.ArchivedAt != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot complete an archived habit"})
+		return
+	}
+
 	if !existingHabit.IsActive {
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot complete an inactive habit"})
 		return
 	}
 
+	if existingHabit.Polarity == store.PolarityQuit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "quit habits are not completed; log an entry to record a relapse"})
+		return
+	}
+
 	var completedHabitEntry store.HabitEntry
-	completedHabitEntry.HabitID = habitID
+	completedHabitEntry.Value = 1
 
 	err = json.NewDecoder(r.Body).Decode(&completedHabitEntry)
 	if err != nil {
@@ -216,7 +596,19 @@ func (hh *HabitHandler) HandleCompleteHabit(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Verify habit belongs to user
+	completedHabitEntry.HabitID = habitID
+
+	if completedHabitEntry.Value <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "value must be greater than zero"})
+		return
+	}
+
+	if completedHabitEntry.DurationSeconds < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "duration_seconds cannot be negative"})
+		return
+	}
+
+	completedHabitEntry.CompletedBy = completedBy(r)
 
 	createdCompletedHabitEntry, err := hh.habitStore.LogHabit(&completedHabitEntry)
 	if err != nil {
@@ -225,9 +617,91 @@ func (hh *HabitHandler) HandleCompleteHabit(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	hh.entryLogged(r, createdCompletedHabitEntry)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"completedHabitEntry": createdCompletedHabitEntry, "message": "Habit completed successfully"})
 }
 
+func (hh *HabitHandler) HandleStartTimer(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	existingHabit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingHabit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	if existingHabit.ArchivedAt != nil || !existingHabit.IsActive {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "cannot time an archived or inactive habit"})
+		return
+	}
+
+	timer, err := hh.habitStore.StartTimer(habitID, completedBy(r))
+	if err != nil {
+		hh.logger.Printf("ERROR: startTimer: %v", err)
+
+		if err.Error() == "timer already running" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "timer already running"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to start timer"})
+		return
+	}
+
+	hh.audit.record(r, auditCreate, "habit_timer", habitID, nil, timer)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"timer": timer})
+}
+
+func (hh *HabitHandler) HandleStopTimer(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var stopRequest struct {
+		Note string `json:"note"`
+	}
+
+	// The body is optional; an empty one just means no note.
+	err = json.NewDecoder(r.Body).Decode(&stopRequest)
+	if err != nil && err != io.EOF {
+		hh.logger.Printf("ERROR: decodingStopTimer: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	habitEntry, err := hh.habitStore.StopTimer(habitID, stopRequest.Note, completedBy(r))
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no timer running for this habit"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: stopTimer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to stop timer"})
+		return
+	}
+
+	hh.entryLogged(r, habitEntry)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habitEntry": habitEntry})
+}
+
 func (hh *HabitHandler) HandleCreateTagToHabit(w http.ResponseWriter, r *http.Request) {
 	habitID, err := utils.ReadIDParam(r)
 	if err != nil {
@@ -267,6 +741,8 @@ func (hh *HabitHandler) HandleCreateTagToHabit(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	hh.audit.record(r, auditCreate, "habit_tag", habitID, nil, requestBody)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"message": "tag added to habit successfully"})
 }
 
@@ -310,6 +786,8 @@ func (hh *HabitHandler) HandleDeleteTagFromHabit(w http.ResponseWriter, r *http.
 		return
 	}
 
+	hh.audit.record(r, auditDelete, "habit_tag", habitID, utils.Envelope{"tag_id": tagID}, nil)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "tag removed from habit successfully"})
 }
 
@@ -321,7 +799,7 @@ func (hh *HabitHandler) HandleGetHabitsByTag(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	habits, err := hh.habitStore.GetHabitsByTag(tagID)
+	habits, err := hh.habitStore.GetHabitsByTag(tagID, middleware.GetUser(r).ID)
 	if err != nil {
 		hh.logger.Printf("ERROR: getHabitsByTag: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habits by tag"})
@@ -330,3 +808,734 @@ func (hh *HabitHandler) HandleGetHabitsByTag(w http.ResponseWriter, r *http.Requ
 
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habits": habits})
 }
+
+func (hh *HabitHandler) HandleCreateHabitPause(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var pauseRequest struct {
+		StartDate string  `json:"start_date"`
+		EndDate   *string `json:"end_date"`
+		Reason    string  `json:"reason"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&pauseRequest)
+	if err != nil {
+		hh.logger.Printf("ERROR: decodingCreatePause: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	pause := &store.HabitPause{HabitID: habitID, Reason: pauseRequest.Reason}
+
+	pause.StartDate, err = utils.ParseDate(pauseRequest.StartDate)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if pauseRequest.EndDate != nil {
+		endDate, err := utils.ParseDate(*pauseRequest.EndDate)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		if endDate.Before(pause.StartDate) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "end_date must not be before start_date"})
+			return
+		}
+		pause.EndDate = &endDate
+	}
+
+	existingHabit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingHabit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	createdPause, err := hh.habitStore.AddPause(pause)
+	if err != nil {
+		hh.logger.Printf("ERROR: addPause: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to pause habit"})
+		return
+	}
+
+	hh.audit.record(r, auditCreate, "habit_pause", createdPause.ID, nil, createdPause)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"pause": createdPause})
+}
+
+func (hh *HabitHandler) HandleGetHabitPauses(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	pauses, err := hh.habitStore.GetPauses(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getPauses: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve pauses"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"pauses": pauses})
+}
+
+func (hh *HabitHandler) HandleDeleteHabitPause(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	pauseID, err := utils.ReadUUIDParam(r, "pauseID")
+	if err != nil {
+		hh.logger.Printf("ERROR: readPauseIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid pause id"})
+		return
+	}
+
+	err = hh.habitStore.DeletePause(habitID, pauseID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "pause not found"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: deletePause: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete pause"})
+		return
+	}
+
+	hh.audit.record(r, auditDelete, "habit_pause", pauseID, nil, nil)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "pause deleted successfully"})
+}
+
+func (hh *HabitHandler) HandleSkipHabitDay(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var skipRequest struct {
+		Date   string `json:"date"`
+		Reason string `json:"reason"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&skipRequest)
+	if err != nil {
+		hh.logger.Printf("ERROR: decodingCreateSkip: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	skip := &store.HabitSkip{HabitID: habitID, Reason: skipRequest.Reason}
+
+	if skipRequest.Date == "" {
+		skip.SkipDate = stats.Day(time.Now())
+	} else {
+		skip.SkipDate, err = utils.ParseDate(skipRequest.Date)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	existingHabit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingHabit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	createdSkip, err := hh.habitStore.AddSkip(skip)
+	if err != nil {
+		hh.logger.Printf("ERROR: addSkip: %v", err)
+
+		if err.Error() == "day already skipped" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "day already skipped"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to skip day"})
+		return
+	}
+
+	hh.audit.record(r, auditCreate, "habit_skip", createdSkip.ID, nil, createdSkip)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"skip": createdSkip})
+}
+
+func (hh *HabitHandler) HandleGetHabitSkips(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	skips, err := hh.habitStore.GetSkips(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getSkips: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve skipped days"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"skips": skips})
+}
+
+func (hh *HabitHandler) HandleDeleteHabitSkip(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	skipID, err := utils.ReadUUIDParam(r, "skipID")
+	if err != nil {
+		hh.logger.Printf("ERROR: readSkipIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid skip id"})
+		return
+	}
+
+	err = hh.habitStore.DeleteSkip(habitID, skipID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "skipped day not found"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: deleteSkip: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete skipped day"})
+		return
+	}
+
+	hh.audit.record(r, auditDelete, "habit_skip", skipID, nil, nil)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "skipped day deleted successfully"})
+}
+
+func (hh *HabitHandler) HandleGetHabitStats(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	habit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if habit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	input, err := loadStatsInput(hh.habitStore, habit)
+	if err != nil {
+		hh.logger.Printf("ERROR: loadStatsInput: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute stats"})
+		return
+	}
+
+	response := utils.Envelope{"stats": stats.Compute(input), "unit": habit.Unit}
+
+	if habit.GroupID != nil {
+		contributions, err := hh.periodContributions(habit, input.Now)
+		if err != nil {
+			hh.logger.Printf("ERROR: periodContributions: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute stats"})
+			return
+		}
+		response["contributions"] = contributions
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+type memberContribution struct {
+	UserID  *uuid.UUID `json:"user_id"`
+	Entries int        `json:"entries"`
+	Value   float64    `json:"value"`
+}
+
+// periodContributions splits a group habit's current period by who logged
+// each entry, most entries first. Entries with no recorded member are
+// grouped under a nil user.
+func (hh *HabitHandler) periodContributions(habit *store.Habit, now time.Time) ([]*memberContribution, error) {
+	entries, err := hh.habitStore.GetHabitEntries(habit.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := stats.PeriodStart(now, habit.Frequency)
+	byUser := make(map[uuid.UUID]*memberContribution)
+	contributions := []*memberContribution{}
+	for _, entry := range entries {
+		if entry.Completion.Before(start) {
+			continue
+		}
+
+		key := uuid.Nil
+		if entry.CompletedBy != nil {
+			key = *entry.CompletedBy
+		}
+
+		contribution, ok := byUser[key]
+		if !ok {
+			contribution = &memberContribution{UserID: entry.CompletedBy}
+			byUser[key] = contribution
+			contributions = append(contributions, contribution)
+		}
+		contribution.Entries++
+		contribution.Value += entry.Value
+	}
+
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Entries > contributions[j].Entries
+	})
+
+	return contributions, nil
+}
+
+type habitHistoryItem struct {
+	*store.HabitVersion
+	// Changed names the fields that differ from the previous version; it is
+	// empty for the first one.
+	Changed []string `json:"changed"`
+}
+
+// HandleGetHabitHistory lists every version of a habit's name, frequency and
+// targets, oldest first, with the fields each one changed.
+func (hh *HabitHandler) HandleGetHabitHistory(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	habit, err := hh.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if habit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	versions, err := hh.habitStore.GetHabitVersions(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitVersions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habit history"})
+		return
+	}
+
+	history := []habitHistoryItem{}
+	for i, version := range versions {
+		item := habitHistoryItem{HabitVersion: version, Changed: []string{}}
+		if i > 0 {
+			previous := versions[i-1]
+			if version.Name != previous.Name {
+				item.Changed = append(item.Changed, "name")
+			}
+			if version.Frequency != previous.Frequency {
+				item.Changed = append(item.Changed, "frequency")
+			}
+			if version.TargetCount != previous.TargetCount {
+				item.Changed = append(item.Changed, "target_count")
+			}
+			if !equalOptional(version.TargetAmount, previous.TargetAmount) {
+				item.Changed = append(item.Changed, "target_amount")
+			}
+			if !equalOptional(version.TargetDurationSeconds, previous.TargetDurationSeconds) {
+				item.Changed = append(item.Changed, "target_duration_seconds")
+			}
+		}
+		history = append(history, item)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"history": history})
+}
+
+func equalOptional[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// loadStatsInput loads everything stats.Compute needs for a single habit.
+func loadStatsInput(habitStore store.HabitStore, habit *store.Habit) (stats.Input, error) {
+	entries, err := habitStore.GetHabitEntries(habit.ID)
+	if err != nil {
+		return stats.Input{}, err
+	}
+
+	return buildStatsInput(habitStore, habit, entries)
+}
+
+// buildStatsInput is loadStatsInput for a caller that has already picked
+// which of the habit's entries count.
+func buildStatsInput(habitStore store.HabitStore, habit *store.Habit, entries []*store.HabitEntry) (stats.Input, error) {
+	pauses, err := habitStore.GetPauses(habit.ID)
+	if err != nil {
+		return stats.Input{}, err
+	}
+
+	skips, err := habitStore.GetSkips(habit.ID)
+	if err != nil {
+		return stats.Input{}, err
+	}
+
+	versions, err := habitStore.GetHabitVersions(habit.ID)
+	if err != nil {
+		return stats.Input{}, err
+	}
+
+	input := stats.Input{
+		Quit:            habit.Polarity == store.PolarityQuit,
+		Frequency:       habit.Frequency,
+		TargetCount:     habit.TargetCount,
+		CreatedAt:       habit.CreatedAt,
+		FreezesPerMonth: habit.FreezesPerMonth,
+		Now:             time.Now(),
+	}
+
+	if habit.TargetAmount != nil {
+		input.TargetAmount = *habit.TargetAmount
+	}
+	if habit.TargetDurationSeconds != nil {
+		input.TargetDuration = time.Duration(*habit.TargetDurationSeconds) * time.Second
+	}
+
+	for _, version := range versions {
+		target := stats.Target{From: version.EffectiveFrom, Count: version.TargetCount}
+		if version.TargetAmount != nil {
+			target.Amount = *version.TargetAmount
+		}
+		if version.TargetDurationSeconds != nil {
+			target.Duration = time.Duration(*version.TargetDurationSeconds) * time.Second
+		}
+		input.History = append(input.History, target)
+	}
+
+	for _, entry := range entries {
+		input.Entries = append(input.Entries, stats.Entry{
+			At:       entry.Completion,
+			Value:    entry.Value,
+			Duration: time.Duration(entry.DurationSeconds) * time.Second,
+		})
+	}
+
+	for _, pause := range pauses {
+		dateRange := stats.DateRange{Start: pause.StartDate}
+		if pause.EndDate != nil {
+			dateRange.End = *pause.EndDate
+		}
+		input.Pauses = append(input.Pauses, dateRange)
+	}
+
+	for _, skip := range skips {
+		input.Skips = append(input.Skips, skip.SkipDate)
+	}
+
+	return input, nil
+}
+
+type agendaItem struct {
+	Habit     *store.Habit `json:"habit"`
+	Progress  float64      `json:"progress"`
+	Target    float64      `json:"target"`
+	Completed bool         `json:"completed"`
+}
+
+// HandleGetAgenda lists the habits that still need attention in their current
+// period. Archived, inactive, paused and skipped habits are left out, and so
+// are quit habits: there is nothing to do for them except not relapse. A
+// stacked habit only shows up once the habits it follows are done today.
+func (hh *HabitHandler) HandleGetAgenda(w http.ResponseWriter, r *http.Request) {
+	habits, err := hh.habitStore.GetHabitsForUser(middleware.GetUser(r).ID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabits: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve agenda"})
+		return
+	}
+
+	links, err := hh.habitStore.GetAllHabitLinks()
+	if err != nil {
+		hh.logger.Printf("ERROR: getAllHabitLinks: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve agenda"})
+		return
+	}
+
+	candidates := []agendaItem{}
+	doneToday := make(map[uuid.UUID]bool)
+	for _, habit := range habits {
+		if !habit.IsActive || habit.Polarity == store.PolarityQuit {
+			continue
+		}
+
+		input, err := loadStatsInput(hh.habitStore, habit)
+		if err != nil {
+			hh.logger.Printf("ERROR: loadStatsInput: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve agenda"})
+			return
+		}
+
+		if excusedToday(input) {
+			continue
+		}
+
+		today := stats.Day(input.Now)
+		for _, entry := range input.Entries {
+			if stats.Day(entry.At).Equal(today) {
+				doneToday[habit.ID] = true
+				break
+			}
+		}
+
+		summary := stats.Compute(input)
+		candidates = append(candidates, agendaItem{
+			Habit:     habit,
+			Progress:  summary.CurrentProgress,
+			Target:    summary.Target,
+			Completed: summary.CurrentProgress >= summary.Target,
+		})
+	}
+
+	// Only anchors that are themselves on the agenda can hold a habit back;
+	// a paused or archived anchor shouldn't hide what is stacked on it.
+	onAgenda := make(map[uuid.UUID]bool)
+	for _, item := range candidates {
+		onAgenda[item.Habit.ID] = true
+	}
+
+	waiting := make(map[uuid.UUID]bool)
+	for _, link := range links {
+		if onAgenda[link.AfterHabitID] && !doneToday[link.AfterHabitID] {
+			waiting[link.HabitID] = true
+		}
+	}
+
+	agenda := []agendaItem{}
+	for _, item := range candidates {
+		if !waiting[item.Habit.ID] {
+			agenda = append(agenda, item)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"agenda": agenda})
+}
+
+func excusedToday(input stats.Input) bool {
+	today := stats.Day(input.Now)
+
+	for _, pause := range input.Pauses {
+		if pause.Contains(today) {
+			return true
+		}
+	}
+
+	for _, skip := range input.Skips {
+		if stats.Day(skip).Equal(today) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hh *HabitHandler) HandleCreateHabitLink(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var linkRequest struct {
+		AfterHabitID uuid.UUID `json:"after_habit_id"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&linkRequest)
+	if err != nil {
+		hh.logger.Printf("ERROR: decodingCreateHabitLink: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	// The route already checked habitID; stacking after a habit also shows
+	// its completions, so the caller must at least be able to read it.
+	readable, err := hh.canRead(middleware.GetUser(r), linkRequest.AfterHabitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: canRead: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !readable {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	link, err := hh.habitStore.AddHabitLink(habitID, linkRequest.AfterHabitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: addHabitLink: %v", err)
+
+		switch err.Error() {
+		case "habit cannot stack after itself", "habit link would create a cycle":
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		case "habit link already exists":
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		default:
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to link habits"})
+		}
+		return
+	}
+
+	hh.audit.record(r, auditCreate, "habit_link", link.ID, nil, link)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"link": link})
+}
+
+type habitLinkStats struct {
+	Link *store.HabitLink `json:"link"`
+	stats.PairSummary
+}
+
+// HandleGetHabitLinks lists a habit's stacking links together with how often
+// each pair has been completed on the same day.
+func (hh *HabitHandler) HandleGetHabitLinks(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	links, err := hh.habitStore.GetHabitLinks(habitID)
+	if err != nil {
+		hh.logger.Printf("ERROR: getHabitLinks: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habit links"})
+		return
+	}
+
+	completions := make(map[uuid.UUID][]time.Time)
+	loadCompletions := func(id uuid.UUID) ([]time.Time, error) {
+		if times, ok := completions[id]; ok {
+			return times, nil
+		}
+		entries, err := hh.habitStore.GetHabitEntries(id)
+		if err != nil {
+			return nil, err
+		}
+		times := []time.Time{}
+		for _, entry := range entries {
+			times = append(times, entry.Completion)
+		}
+		completions[id] = times
+		return times, nil
+	}
+
+	user := middleware.GetUser(r)
+	result := []habitLinkStats{}
+	for _, link := range links {
+		// Links survive a partner being revoked or a member leaving a group,
+		// so the habit on the other side is checked every time.
+		other := link.AfterHabitID
+		if other == habitID {
+			other = link.HabitID
+		}
+
+		readable, err := hh.canRead(user, other)
+		if err != nil {
+			hh.logger.Printf("ERROR: canRead: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habit links"})
+			return
+		}
+
+		if !readable {
+			continue
+		}
+
+		anchor, err := loadCompletions(link.AfterHabitID)
+		if err != nil {
+			hh.logger.Printf("ERROR: getHabitEntries: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habit links"})
+			return
+		}
+
+		stacked, err := loadCompletions(link.HabitID)
+		if err != nil {
+			hh.logger.Printf("ERROR: getHabitEntries: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve habit links"})
+			return
+		}
+
+		result = append(result, habitLinkStats{Link: link, PairSummary: stats.Pair(anchor, stacked)})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"links": result})
+}
+
+func (hh *HabitHandler) HandleDeleteHabitLink(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		hh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	linkID, err := utils.ReadUUIDParam(r, "linkID")
+	if err != nil {
+		hh.logger.Printf("ERROR: readLinkIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid link id"})
+		return
+	}
+
+	err = hh.habitStore.RemoveHabitLink(habitID, linkID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit link not found"})
+		return
+	}
+
+	if err != nil {
+		hh.logger.Printf("ERROR: removeHabitLink: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to remove habit link"})
+		return
+	}
+
+	hh.audit.record(r, auditDelete, "habit_link", linkID, nil, nil)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "habit link removed successfully"})
+}
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+)
+
+// fakeHabitStore serves habits from memory. Methods the tests don't need
+// fall through to the embedded nil interface and panic.
+type fakeHabitStore struct {
+	store.HabitStore
+	habits map[uuid.UUID]*store.Habit
+	// roles maps a habit and user to the user's role in the habit's group.
+	roles   map[[2]uuid.UUID]string
+	entries []*store.HabitEntry
+	links   []*store.HabitLink
+}
+
+func (f *fakeHabitStore) GetHabitByID(id uuid.UUID) (*store.Habit, error) {
+	habit := f.habits[id]
+	if habit == nil || habit.DeletedAt != nil {
+		return nil, nil
+	}
+	return habit, nil
+}
+
+func (f *fakeHabitStore) GetHabitIncludingTrashed(id uuid.UUID) (*store.Habit, error) {
+	return f.habits[id], nil
+}
+
+func (f *fakeHabitStore) GetHabitGroupRole(habitID, userID uuid.UUID) (string, error) {
+	return f.roles[[2]uuid.UUID{habitID, userID}], nil
+}
+
+func (f *fakeHabitStore) LogHabit(entry *store.HabitEntry) (*store.HabitEntry, error) {
+	entry.ID = uuid.New()
+	f.entries = append(f.entries, entry)
+	return entry, nil
+}
+
+func (f *fakeHabitStore) AddHabitLink(habitID, afterHabitID uuid.UUID) (*store.HabitLink, error) {
+	link := &store.HabitLink{ID: uuid.New(), HabitID: habitID, AfterHabitID: afterHabitID}
+	f.links = append(f.links, link)
+	return link, nil
+}
+
+func (f *fakeHabitStore) GetHabitLinks(habitID uuid.UUID) ([]*store.HabitLink, error) {
+	var links []*store.HabitLink
+	for _, link := range f.links {
+		if link.HabitID == habitID || link.AfterHabitID == habitID {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (f *fakeHabitStore) GetHabitEntries(habitID uuid.UUID) ([]*store.HabitEntry, error) {
+	var entries []*store.HabitEntry
+	for _, entry := range f.entries {
+		if entry.HabitID == habitID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type fakePartnerStore struct {
+	store.PartnerStore
+	// partners maps a habit and user to whether the user is an accepted partner.
+	partners map[[2]uuid.UUID]bool
+}
+
+func (f *fakePartnerStore) IsPartner(habitID, userID uuid.UUID) (bool, error) {
+	return f.partners[[2]uuid.UUID{habitID, userID}], nil
+}
+
+type fakeAuditStore struct {
+	store.AuditStore
+}
+
+func (f *fakeAuditStore) RecordAudit(entry *store.AuditEntry) error {
+	return nil
+}
+
+func TestRequireHabitAccess(t *testing.T) {
+	owner := &store.User{ID: uuid.New()}
+	member := &store.User{ID: uuid.New()}
+	admin := &store.User{ID: uuid.New()}
+	partner := &store.User{ID: uuid.New()}
+	stranger := &store.User{ID: uuid.New()}
+	deletedAt := time.Now()
+	groupID := uuid.New()
+
+	ownHabit := &store.Habit{ID: uuid.New(), UserID: &owner.ID}
+	trashedHabit := &store.Habit{ID: uuid.New(), UserID: &owner.ID, DeletedAt: &deletedAt}
+	groupHabit := &store.Habit{ID: uuid.New(), GroupID: &groupID}
+	ownerlessHabit := &store.Habit{ID: uuid.New()}
+
+	habitStore := &fakeHabitStore{
+		habits: map[uuid.UUID]*store.Habit{
+			ownHabit.ID:       ownHabit,
+			trashedHabit.ID:   trashedHabit,
+			groupHabit.ID:     groupHabit,
+			ownerlessHabit.ID: ownerlessHabit,
+		},
+		roles: map[[2]uuid.UUID]string{
+			{groupHabit.ID, member.ID}: store.GroupRoleMember,
+			{groupHabit.ID, admin.ID}:  store.GroupRoleAdmin,
+		},
+	}
+	partnerStore := &fakePartnerStore{
+		partners: map[[2]uuid.UUID]bool{
+			{ownHabit.ID, partner.ID}:     true,
+			{trashedHabit.ID, partner.ID}: true,
+		},
+	}
+	hh := NewHabitHandler(habitStore, partnerStore, nil, log.New(io.Discard, "", 0))
+
+	tests := []struct {
+		name    string
+		level   habitAccess
+		user    *store.User
+		habitID string
+		want    int
+	}{
+		{"owner manages own habit", accessOwner, owner, ownHabit.ID.String(), http.StatusOK},
+		{"partner reads shared habit", accessRead, partner, ownHabit.ID.String(), http.StatusOK},
+		{"partner cannot log shared habit", accessLog, partner, ownHabit.ID.String(), http.StatusForbidden},
+		{"stranger cannot see habit", accessRead, stranger, ownHabit.ID.String(), http.StatusNotFound},
+		{"anonymous cannot see habit", accessRead, store.AnonymousUser, ownHabit.ID.String(), http.StatusNotFound},
+		{"owner restores trashed habit", accessOwner, owner, trashedHabit.ID.String(), http.StatusOK},
+		{"stranger cannot restore trashed habit", accessOwner, stranger, trashedHabit.ID.String(), http.StatusNotFound},
+		{"anonymous cannot restore trashed habit", accessOwner, store.AnonymousUser, trashedHabit.ID.String(), http.StatusNotFound},
+		{"partner cannot restore trashed habit", accessOwner, partner, trashedHabit.ID.String(), http.StatusForbidden},
+		{"group member logs group habit", accessLog, member, groupHabit.ID.String(), http.StatusOK},
+		{"group member cannot manage group habit", accessOwner, member, groupHabit.ID.String(), http.StatusForbidden},
+		{"group admin manages group habit", accessOwner, admin, groupHabit.ID.String(), http.StatusOK},
+		{"outsider cannot log group habit", accessLog, stranger, groupHabit.ID.String(), http.StatusNotFound},
+		{"anyone manages ownerless habit", accessOwner, store.AnonymousUser, ownerlessHabit.ID.String(), http.StatusOK},
+		{"missing habit is left to the handler", accessOwner, stranger, uuid.New().String(), http.StatusOK},
+		{"malformed id is left to the handler", accessOwner, stranger, "not-a-uuid", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := chi.NewRouter()
+			router.Post("/habits/{id}", hh.requireHabitAccess(tt.level, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/habits/"+tt.habitID, nil)
+			req = middleware.SetUser(req, tt.user)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleLogHabitCompletionsValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      int
+		wantValue float64
+	}{
+		{"value defaults to one", `{}`, http.StatusCreated, 1},
+		{"fractional value", `{"value": 2.5}`, http.StatusCreated, 2.5},
+		{"zero value", `{"value": 0}`, http.StatusBadRequest, 0},
+		{"negative value", `{"value": -3}`, http.StatusBadRequest, 0},
+		{"duration", `{"durationSeconds": 600}`, http.StatusCreated, 1},
+		{"negative duration", `{"durationSeconds": -60}`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habit := &store.Habit{ID: uuid.New()}
+			habitStore := &fakeHabitStore{habits: map[uuid.UUID]*store.Habit{habit.ID: habit}}
+			hh := NewHabitHandler(habitStore, &fakePartnerStore{}, &fakeAuditStore{}, log.New(io.Discard, "", 0))
+
+			router := chi.NewRouter()
+			router.Post("/habits/{id}/log", hh.HandleLogHabitCompletions)
+
+			req := httptest.NewRequest(http.MethodPost, "/habits/"+habit.ID.String()+"/log", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+
+			if tt.want != http.StatusCreated {
+				if len(habitStore.entries) != 0 {
+					t.Errorf("logged %d entries, want none", len(habitStore.entries))
+				}
+				return
+			}
+
+			if len(habitStore.entries) != 1 || habitStore.entries[0].Value != tt.wantValue {
+				t.Errorf("logged %+v, want one entry with value %v", habitStore.entries, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestHandleLogHabitCompletionsHabitState(t *testing.T) {
+	now := time.Now()
+	active := &store.Habit{ID: uuid.New()}
+	archived := &store.Habit{ID: uuid.New(), ArchivedAt: &now}
+	trashed := &store.Habit{ID: uuid.New(), DeletedAt: &now}
+
+	tests := []struct {
+		name    string
+		habitID uuid.UUID
+		want    int
+	}{
+		{"active habit", active.ID, http.StatusCreated},
+		{"archived habit", archived.ID, http.StatusBadRequest},
+		{"trashed habit", trashed.ID, http.StatusNotFound},
+		{"missing habit", uuid.New(), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			habitStore := &fakeHabitStore{habits: map[uuid.UUID]*store.Habit{
+				active.ID:   active,
+				archived.ID: archived,
+				trashed.ID:  trashed,
+			}}
+			hh := NewHabitHandler(habitStore, &fakePartnerStore{}, &fakeAuditStore{}, log.New(io.Discard, "", 0))
+
+			router := chi.NewRouter()
+			router.Post("/habits/{id}/log", hh.HandleLogHabitCompletions)
+
+			req := httptest.NewRequest(http.MethodPost, "/habits/"+tt.habitID.String()+"/log", strings.NewReader(`{}`))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+
+			wantEntries := 0
+			if tt.want == http.StatusCreated {
+				wantEntries = 1
+			}
+			if len(habitStore.entries) != wantEntries {
+				t.Errorf("logged %d entries, want %d", len(habitStore.entries), wantEntries)
+			}
+		})
+	}
+}
+
+func TestLoggedEntryStaysOnPathHabit(t *testing.T) {
+	habit := &store.Habit{ID: uuid.New(), IsActive: true}
+	foreign := uuid.New()
+
+	for _, path := range []string{"/log", "/complete"} {
+		t.Run(path, func(t *testing.T) {
+			habitStore := &fakeHabitStore{habits: map[uuid.UUID]*store.Habit{habit.ID: habit}}
+			hh := NewHabitHandler(habitStore, &fakePartnerStore{}, &fakeAuditStore{}, log.New(io.Discard, "", 0))
+
+			router := chi.NewRouter()
+			router.Post("/habits/{id}/log", hh.HandleLogHabitCompletions)
+			router.Post("/habits/{id}/complete", hh.HandleCompleteHabit)
+
+			body := `{"HabitID": "` + foreign.String() + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/habits/"+habit.ID.String()+path, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusCreated, rec.Body)
+			}
+			if len(habitStore.entries) != 1 || habitStore.entries[0].HabitID != habit.ID {
+				t.Errorf("logged %+v, want one entry on habit %s", habitStore.entries, habit.ID)
+			}
+		})
+	}
+}
+
+func TestHabitLinkAccess(t *testing.T) {
+	owner := &store.User{ID: uuid.New()}
+	other := &store.User{ID: uuid.New()}
+
+	ownHabit := &store.Habit{ID: uuid.New(), UserID: &owner.ID}
+	otherOwnHabit := &store.Habit{ID: uuid.New(), UserID: &owner.ID}
+	sharedHabit := &store.Habit{ID: uuid.New(), UserID: &other.ID}
+	privateHabit := &store.Habit{ID: uuid.New(), UserID: &other.ID}
+
+	newHandler := func() (*HabitHandler, *fakeHabitStore) {
+		habitStore := &fakeHabitStore{
+			habits: map[uuid.UUID]*store.Habit{
+				ownHabit.ID:      ownHabit,
+				otherOwnHabit.ID: otherOwnHabit,
+				sharedHabit.ID:   sharedHabit,
+				privateHabit.ID:  privateHabit,
+			},
+		}
+		partnerStore := &fakePartnerStore{
+			partners: map[[2]uuid.UUID]bool{{sharedHabit.ID, owner.ID}: true},
+		}
+		return NewHabitHandler(habitStore, partnerStore, &fakeAuditStore{}, log.New(io.Discard, "", 0)), habitStore
+	}
+
+	t.Run("create", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			afterID uuid.UUID
+			want    int
+		}{
+			{"after own habit", otherOwnHabit.ID, http.StatusCreated},
+			{"after partner-shared habit", sharedHabit.ID, http.StatusCreated},
+			{"after someone else's habit", privateHabit.ID, http.StatusNotFound},
+			{"after missing habit", uuid.New(), http.StatusNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hh, habitStore := newHandler()
+				router := chi.NewRouter()
+				router.Post("/habits/{id}/links", hh.HandleCreateHabitLink)
+
+				body := `{"after_habit_id": "` + tt.afterID.String() + `"}`
+				req := httptest.NewRequest(http.MethodPost, "/habits/"+ownHabit.ID.String()+"/links", strings.NewReader(body))
+				req = middleware.SetUser(req, owner)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != tt.want {
+					t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+				}
+				if tt.want != http.StatusCreated && len(habitStore.links) != 0 {
+					t.Errorf("stored %d links, want none", len(habitStore.links))
+				}
+			})
+		}
+	})
+
+	t.Run("list hides habits the caller can't read", func(t *testing.T) {
+		hh, habitStore := newHandler()
+		habitStore.links = []*store.HabitLink{
+			{ID: uuid.New(), HabitID: ownHabit.ID, AfterHabitID: sharedHabit.ID},
+			{ID: uuid.New(), HabitID: privateHabit.ID, AfterHabitID: ownHabit.ID},
+		}
+
+		router := chi.NewRouter()
+		router.Get("/habits/{id}/links", hh.HandleGetHabitLinks)
+
+		req := httptest.NewRequest(http.MethodGet, "/habits/"+ownHabit.ID.String()+"/links", nil)
+		req = middleware.SetUser(req, owner)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusOK, rec.Body)
+		}
+
+		var response struct {
+			Links []struct {
+				Link struct {
+					ID uuid.UUID
+				} `json:"link"`
+			} `json:"links"`
+		}
+		err := json.Unmarshal(rec.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+
+		if len(response.Links) != 1 || response.Links[0].Link.ID != habitStore.links[0].ID {
+			t.Errorf("links = %s, want only the link to the shared habit", rec.Body)
+		}
+	})
+}
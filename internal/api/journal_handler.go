@@ -0,0 +1,297 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type JournalHandler struct {
+	journalStore store.JournalStore
+	habitStore   store.HabitStore
+	logger       *log.Logger
+}
+
+func NewJournalHandler(journalStore store.JournalStore, habitStore store.HabitStore, logger *log.Logger) *JournalHandler {
+	return &JournalHandler{
+		journalStore: journalStore,
+		habitStore:   habitStore,
+		logger:       logger,
+	}
+}
+
+// readDateRange parses the optional from and to query parameters.
+func readDateRange(r *http.Request) (from, to time.Time, err error) {
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = utils.ParseDate(value)
+		if err != nil {
+			return from, to, err
+		}
+	}
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = utils.ParseDate(value)
+	}
+
+	return from, to, err
+}
+
+func (jh *JournalHandler) HandleCreateJournalEntry(w http.ResponseWriter, r *http.Request) {
+	var createJournalRequest struct {
+		Date   string `json:"date"`
+		Body   string `json:"body"`
+		Mood   *int   `json:"mood"`
+		Energy *int   `json:"energy"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createJournalRequest)
+	if err != nil {
+		jh.logger.Printf("ERROR: decodingCreateJournalEntry: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	date, err := utils.ParseDate(createJournalRequest.Date)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if !store.ValidRating(createJournalRequest.Mood) || !store.ValidRating(createJournalRequest.Energy) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mood and energy must be between 1 and 5"})
+		return
+	}
+
+	entry := &store.JournalEntry{
+		UserID: middleware.GetUser(r).ID,
+		Date:   date,
+		Body:   createJournalRequest.Body,
+		Mood:   createJournalRequest.Mood,
+		Energy: createJournalRequest.Energy,
+	}
+
+	createdEntry, err := jh.journalStore.CreateJournalEntry(entry)
+	if err != nil {
+		jh.logger.Printf("ERROR: createJournalEntry: %v", err)
+
+		if err.Error() == "journal entry for this date already exists" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create journal entry"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"journal": createdEntry})
+}
+
+func (jh *JournalHandler) HandleGetJournalEntries(w http.ResponseWriter, r *http.Request) {
+	from, to, err := readDateRange(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	entries, err := jh.journalStore.GetJournalEntries(middleware.GetUser(r).ID, from, to)
+	if err != nil {
+		jh.logger.Printf("ERROR: getJournalEntries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve journal"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"journal": entries})
+}
+
+func (jh *JournalHandler) HandleGetJournalEntryByDate(w http.ResponseWriter, r *http.Request) {
+	date, err := utils.ParseDate(chi.URLParam(r, "date"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	entry, err := jh.journalStore.GetJournalEntryByDate(middleware.GetUser(r).ID, date)
+	if err != nil {
+		jh.logger.Printf("ERROR: getJournalEntryByDate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if entry == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "journal entry not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"journal": entry})
+}
+
+func (jh *JournalHandler) HandleUpdateJournalEntry(w http.ResponseWriter, r *http.Request) {
+	date, err := utils.ParseDate(chi.URLParam(r, "date"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	existingEntry, err := jh.journalStore.GetJournalEntryByDate(middleware.GetUser(r).ID, date)
+	if err != nil {
+		jh.logger.Printf("ERROR: getJournalEntryByDate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingEntry == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "journal entry not found"})
+		return
+	}
+
+	var updateJournalRequest struct {
+		Body   *string `json:"body"`
+		Mood   *int    `json:"mood"`
+		Energy *int    `json:"energy"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&updateJournalRequest)
+	if err != nil {
+		jh.logger.Printf("ERROR: decodingUpdateRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !store.ValidRating(updateJournalRequest.Mood) || !store.ValidRating(updateJournalRequest.Energy) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mood and energy must be between 1 and 5"})
+		return
+	}
+
+	if updateJournalRequest.Body != nil {
+		existingEntry.Body = *updateJournalRequest.Body
+	}
+	if updateJournalRequest.Mood != nil {
+		existingEntry.Mood = updateJournalRequest.Mood
+	}
+	if updateJournalRequest.Energy != nil {
+		existingEntry.Energy = updateJournalRequest.Energy
+	}
+
+	err = jh.journalStore.UpdateJournalEntry(existingEntry)
+	if err != nil {
+		jh.logger.Printf("ERROR: updatingJournalEntry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"journal": existingEntry})
+}
+
+func (jh *JournalHandler) HandleDeleteJournalEntry(w http.ResponseWriter, r *http.Request) {
+	date, err := utils.ParseDate(chi.URLParam(r, "date"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = jh.journalStore.DeleteJournalEntry(middleware.GetUser(r).ID, date)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "journal entry not found"})
+		return
+	}
+
+	if err != nil {
+		jh.logger.Printf("ERROR: deleteJournalEntry: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting journal entry"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "journal entry deleted successfully"})
+}
+
+type habitMood struct {
+	HabitID  uuid.UUID `json:"habit_id"`
+	Name     string    `json:"name"`
+	Polarity string    `json:"polarity"`
+	stats.MoodSummary
+}
+
+// HandleGetJournalStats reports the average mood and energy over the range
+// and, for each of the user's habits, how mood differs on the days it was done.
+func (jh *JournalHandler) HandleGetJournalStats(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	from, to, err := readDateRange(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	entries, err := jh.journalStore.GetJournalEntries(user.ID, from, to)
+	if err != nil {
+		jh.logger.Printf("ERROR: getJournalEntries: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute journal stats"})
+		return
+	}
+
+	moods := make(map[time.Time]int)
+	var moodTotal, energyTotal, energyDays int
+	for _, entry := range entries {
+		if entry.Mood != nil {
+			moods[stats.Day(entry.Date)] = *entry.Mood
+			moodTotal += *entry.Mood
+		}
+		if entry.Energy != nil {
+			energyTotal += *entry.Energy
+			energyDays++
+		}
+	}
+
+	habits, err := jh.habitStore.GetHabitsForUser(user.ID)
+	if err != nil {
+		jh.logger.Printf("ERROR: getHabitsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute journal stats"})
+		return
+	}
+
+	correlations := []habitMood{}
+	for _, habit := range habits {
+		habitEntries, err := jh.habitStore.GetHabitEntries(habit.ID)
+		if err != nil {
+			jh.logger.Printf("ERROR: getHabitEntries: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to compute journal stats"})
+			return
+		}
+
+		completions := make([]time.Time, 0, len(habitEntries))
+		for _, entry := range habitEntries {
+			completions = append(completions, entry.Completion)
+		}
+
+		correlations = append(correlations, habitMood{
+			HabitID:     habit.ID,
+			Name:        habit.Name,
+			Polarity:    habit.Polarity,
+			MoodSummary: stats.Mood(moods, completions),
+		})
+	}
+
+	var averageMood, averageEnergy float64
+	if len(moods) > 0 {
+		averageMood = float64(moodTotal) / float64(len(moods))
+	}
+	if energyDays > 0 {
+		averageEnergy = float64(energyTotal) / float64(energyDays)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"days":           len(entries),
+		"average_mood":   averageMood,
+		"average_energy": averageEnergy,
+		"habits":         correlations,
+	})
+}
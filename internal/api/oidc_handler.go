@@ -0,0 +1,287 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/oidc"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcNonceCookie = "oidc_nonce"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// errUnverifiedAccount is returned by resolveUser when the provider's email
+// belongs to a local account whose owner never verified it. Linking would
+// hand the account to whoever controls the provider login, while whoever
+// registered it could still sign in with its password.
+var errUnverifiedAccount = errors.New("local account email is not verified")
+
+// OIDCHandler signs users in through an external OpenID Connect provider.
+// provider is nil when OIDC isn't configured, and the routes answer 404.
+type OIDCHandler struct {
+	provider      *oidc.Provider
+	userStore     store.UserStore
+	identityStore store.IdentityStore
+	tokenStore    store.TokenStore
+	logger        *log.Logger
+}
+
+func NewOIDCHandler(provider *oidc.Provider, userStore store.UserStore, identityStore store.IdentityStore, tokenStore store.TokenStore, logger *log.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		provider:      provider,
+		userStore:     userStore,
+		identityStore: identityStore,
+		tokenStore:    tokenStore,
+		logger:        logger,
+	}
+}
+
+// HandleLogin redirects to the provider. The state and nonce are kept in
+// short-lived cookies and checked again on the callback.
+func (oh *OIDCHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if oh.provider == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "single sign-on is not configured"})
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		oh.logger.Printf("ERROR: generatingState: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		oh.logger.Printf("ERROR: generatingNonce: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	authURL, err := oh.provider.AuthCodeURL(r.Context(), state, nonce)
+	if err != nil {
+		oh.logger.Printf("ERROR: authCodeURL: %v", err)
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{"error": "single sign-on provider is unavailable"})
+		return
+	}
+
+	setOIDCCookie(w, r, oidcStateCookie, state, oidcLoginTTL)
+	setOIDCCookie(w, r, oidcNonceCookie, nonce, oidcLoginTTL)
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func setOIDCCookie(w http.ResponseWriter, r *http.Request, name, value string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/oidc",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func randomString() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// HandleCallback finishes the authorization code flow and issues a normal
+// auth token. The provider account is matched by its existing link, then by
+// verified email, and otherwise a new user is created. Any second factor is
+// left to the provider, so local TOTP isn't asked for here.
+func (oh *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	if oh.provider == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "single sign-on is not configured"})
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "sign-in was not completed: " + providerError})
+		return
+	}
+
+	stateCookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(query.Get("state"))) != 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired sign-in state"})
+		return
+	}
+
+	nonceCookie, err := r.Cookie(oidcNonceCookie)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired sign-in state"})
+		return
+	}
+
+	setOIDCCookie(w, r, oidcStateCookie, "", -time.Second)
+	setOIDCCookie(w, r, oidcNonceCookie, "", -time.Second)
+
+	code := query.Get("code")
+	if code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	claims, err := oh.provider.Exchange(r.Context(), code, nonceCookie.Value)
+	if err != nil {
+		oh.logger.Printf("ERROR: oidcExchange: %v", err)
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid identity token"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{"error": "failed to complete sign-in with provider"})
+		return
+	}
+
+	user, err := oh.resolveUser(claims)
+	if err == errUnverifiedAccount {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "an account with this email already exists; sign in with your password and verify your email before using this provider"})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: resolveOIDCUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your provider account has no verified email address"})
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this account has been deactivated"})
+		return
+	}
+
+	token, err := oh.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		oh.logger.Printf("ERROR: createNewToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token})
+}
+
+// resolveUser finds or creates the local user for the provider account. It
+// returns nil when the account can't be linked because its email isn't
+// verified by the provider, and errUnverifiedAccount when the email matches a
+// local account that isn't verified either.
+func (oh *OIDCHandler) resolveUser(claims *oidc.Claims) (*store.User, error) {
+	user, err := oh.identityStore.GetUserByIdentity(claims.Issuer, claims.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified || !emailRegex.MatchString(claims.Email) {
+		return nil, nil
+	}
+
+	user, err = oh.userStore.GetUserByEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil && !user.IsVerified() {
+		return nil, errUnverifiedAccount
+	}
+
+	if user == nil {
+		user, err = oh.createUser(claims)
+		if err != nil {
+			return nil, err
+		}
+
+		// The provider vouches for the address, so the new account is
+		// verified too.
+		err = oh.userStore.SetEmailVerified(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = oh.identityStore.LinkIdentity(user.ID, claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return oh.userStore.GetUserByID(user.ID)
+}
+
+// createUser registers a user for a first-time provider login. The username
+// comes from the email's local part, with a random suffix if it's taken, and
+// the password is random so the account can only sign in through the provider
+// until the user resets it.
+func (oh *OIDCHandler) createUser(claims *oidc.Claims) (*store.User, error) {
+	base := usernameUnsafeChars.ReplaceAllString(strings.SplitN(claims.Email, "@", 2)[0], "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	firstName, lastName, _ := strings.Cut(claims.Name, " ")
+
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	user := &store.User{
+		Email:     claims.Email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}
+
+	err = user.PasswordHash.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		user.Username = username
+		err = oh.userStore.CreateUser(user)
+		if err == nil || err.Error() != "username or email already taken" || attempt == 4 {
+			break
+		}
+
+		suffix, err := randomString()
+		if err != nil {
+			return nil, err
+		}
+		username = base + "-" + strings.ToLower(suffix[:6])
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/oidc"
+	"github.com/kevin120202/habit-tracker/internal/oidc/oidctest"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+func (f *fakeUserStore) GetUserByID(id uuid.UUID) (*store.User, error) {
+	return f.users[id], nil
+}
+
+func (f *fakeUserStore) CreateUser(user *store.User) error {
+	user.ID = uuid.New()
+	f.users[user.ID] = user
+	return nil
+}
+
+// fakeIdentityStore maps issuer and subject pairs to users.
+type fakeIdentityStore struct {
+	userStore *fakeUserStore
+	links     map[[2]string]uuid.UUID
+}
+
+func (f *fakeIdentityStore) GetUserByIdentity(issuer, subject string) (*store.User, error) {
+	userID, ok := f.links[[2]string{issuer, subject}]
+	if !ok {
+		return nil, nil
+	}
+	return f.userStore.users[userID], nil
+}
+
+func (f *fakeIdentityStore) LinkIdentity(userID uuid.UUID, issuer, subject string) error {
+	f.links[[2]string{issuer, subject}] = userID
+	return nil
+}
+
+func TestHandleOIDCCallback(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+	existing := uuid.New()
+	unverified := uuid.New()
+	verifiedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		sub   string
+		email string
+		// verified is sent as the provider's email_verified claim.
+		verified bool
+		nonce    string
+		state    string
+		want     int
+		// wantUser is the user signed in, or uuid.Nil for a new one.
+		wantUser   uuid.UUID
+		wantLinked bool
+	}{
+		{"linked account", "sub-linked", "", false, "the-nonce", "the-state", http.StatusCreated, existing, true},
+		{"verified email links existing account", "sub-new", "ada@example.com", true, "the-nonce", "the-state", http.StatusCreated, existing, true},
+		{"unverified email is not linked", "sub-new", "ada@example.com", false, "the-nonce", "the-state", http.StatusForbidden, uuid.Nil, false},
+		{"unverified local account is not linked", "sub-new", "eve@example.com", true, "the-nonce", "the-state", http.StatusForbidden, uuid.Nil, false},
+		{"verified new email creates a user", "sub-new", "grace@example.com", true, "the-nonce", "the-state", http.StatusCreated, uuid.Nil, true},
+		{"nonce mismatch", "sub-new", "grace@example.com", true, "another-nonce", "the-state", http.StatusUnauthorized, uuid.Nil, false},
+		{"state mismatch", "sub-new", "grace@example.com", true, "the-nonce", "another-state", http.StatusBadRequest, uuid.Nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenStore := &fakeTokenStore{tokens: map[string]*tokens.Token{}}
+			userStore := &fakeUserStore{
+				users: map[uuid.UUID]*store.User{
+					existing:   {ID: existing, Username: "ada", Email: "ada@example.com", EmailVerifiedAt: &verifiedAt},
+					unverified: {ID: unverified, Username: "eve", Email: "eve@example.com"},
+				},
+				tokenStore: tokenStore,
+			}
+			identityStore := &fakeIdentityStore{
+				userStore: userStore,
+				links:     map[[2]string]uuid.UUID{{stand.Issuer(), "sub-linked"}: existing},
+			}
+
+			provider := oidc.NewProvider(oidc.Config{
+				Issuer:       stand.Issuer(),
+				ClientID:     stand.ClientID,
+				ClientSecret: stand.ClientSecret,
+				RedirectURL:  "https://habits.example.com/oidc/callback",
+			}, stand.Server.Client())
+			oh := NewOIDCHandler(provider, userStore, identityStore, tokenStore, log.New(io.Discard, "", 0))
+
+			claims := stand.Claims(tt.sub)
+			claims["nonce"] = tt.nonce
+			claims["email_verified"] = tt.verified
+			if tt.email != "" {
+				claims["email"] = tt.email
+			}
+			query := url.Values{"code": {stand.Code(stand.Sign(claims))}, "state": {tt.state}}
+
+			req := httptest.NewRequest(http.MethodGet, "/oidc/callback?"+query.Encode(), nil)
+			req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "the-state"})
+			req.AddCookie(&http.Cookie{Name: oidcNonceCookie, Value: "the-nonce"})
+			rec := httptest.NewRecorder()
+			oh.HandleCallback(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+
+			userID, linked := identityStore.links[[2]string{stand.Issuer(), tt.sub}]
+			if linked != tt.wantLinked {
+				t.Fatalf("linked = %v, want %v", linked, tt.wantLinked)
+			}
+
+			if tt.want != http.StatusCreated {
+				if len(tokenStore.tokens) != 0 {
+					t.Errorf("issued %d tokens, want none", len(tokenStore.tokens))
+				}
+				return
+			}
+
+			if tt.wantUser != uuid.Nil && userID != tt.wantUser {
+				t.Errorf("linked to %v, want %v", userID, tt.wantUser)
+			}
+			if tt.wantUser == uuid.Nil && userID == existing {
+				t.Error("linked to the existing account, want a new user")
+			}
+
+			var signedIn []uuid.UUID
+			for _, token := range tokenStore.tokens {
+				if token.Scope == tokens.ScopeAuth && token.Expiry.After(time.Now()) {
+					signedIn = append(signedIn, token.UserID)
+				}
+			}
+			if len(signedIn) != 1 || signedIn[0] != userID {
+				t.Errorf("signed in %v, want %v", signedIn, userID)
+			}
+			if tt.email != "" && !userStore.users[userID].IsVerified() {
+				t.Error("provider-verified email was not marked verified")
+			}
+		})
+	}
+}
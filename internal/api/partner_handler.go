@@ -0,0 +1,335 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type PartnerHandler struct {
+	partnerStore store.PartnerStore
+	habitStore   store.HabitStore
+	userStore    store.UserStore
+	logger       *log.Logger
+}
+
+func NewPartnerHandler(partnerStore store.PartnerStore, habitStore store.HabitStore, userStore store.UserStore, logger *log.Logger) *PartnerHandler {
+	return &PartnerHandler{
+		partnerStore: partnerStore,
+		habitStore:   habitStore,
+		userStore:    userStore,
+		logger:       logger,
+	}
+}
+
+// HandleInvitePartner invites another user, by username, to follow one of
+// the caller's habits. Habits without an owner can't be shared.
+func (ph *PartnerHandler) HandleInvitePartner(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var invitePartnerRequest struct {
+		Username string `json:"username"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&invitePartnerRequest)
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingInvitePartner: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	habit, err := ph.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		ph.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if habit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if habit.UserID == nil || *habit.UserID != user.ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only habits you own can be shared"})
+		return
+	}
+
+	partnerUser, err := ph.userStore.GetUserByUsername(invitePartnerRequest.Username)
+	if err != nil {
+		ph.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if partnerUser == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	partner, err := ph.partnerStore.InvitePartner(&store.HabitPartner{
+		HabitID:   habitID,
+		OwnerID:   user.ID,
+		PartnerID: partnerUser.ID,
+	})
+	if err != nil {
+		ph.logger.Printf("ERROR: invitePartner: %v", err)
+
+		switch err.Error() {
+		case "user is already a partner on this habit":
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		case "you cannot partner with yourself":
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		default:
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to invite partner"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"partner": partner})
+}
+
+func (ph *PartnerHandler) HandleGetHabitPartners(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	partners, err := ph.partnerStore.GetHabitPartners(habitID)
+	if err != nil {
+		ph.logger.Printf("ERROR: getHabitPartners: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve partners"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"partners": partners})
+}
+
+// HandleGetInvitations lists the invitations waiting on the caller.
+func (ph *PartnerHandler) HandleGetInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := ph.partnerStore.GetPartnershipsForUser(middleware.GetUser(r).ID, store.PartnerPending)
+	if err != nil {
+		ph.logger.Printf("ERROR: getPartnershipsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve invitations"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"invitations": invitations})
+}
+
+func (ph *PartnerHandler) HandleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	ph.respondToInvitation(w, r, true)
+}
+
+func (ph *PartnerHandler) HandleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	ph.respondToInvitation(w, r, false)
+}
+
+func (ph *PartnerHandler) respondToInvitation(w http.ResponseWriter, r *http.Request, accept bool) {
+	invitationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid invitation id"})
+		return
+	}
+
+	partner, err := ph.partnerStore.RespondToInvitation(invitationID, middleware.GetUser(r).ID, accept)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation not found"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: respondToInvitation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"partner": partner})
+}
+
+// HandleRevokePartner ends a partnership from either side, whatever its
+// status.
+func (ph *PartnerHandler) HandleRevokePartner(w http.ResponseWriter, r *http.Request) {
+	partnerID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid partner id"})
+		return
+	}
+
+	err = ph.partnerStore.RevokePartner(partnerID, middleware.GetUser(r).ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "partner not found"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: revokePartner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error revoking partner"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "partner revoked successfully"})
+}
+
+type sharedHabit struct {
+	PartnerID     uuid.UUID `json:"partner_id"`
+	HabitID       uuid.UUID `json:"habit_id"`
+	OwnerID       uuid.UUID `json:"owner_id"`
+	Name          string    `json:"name"`
+	Frequency     string    `json:"frequency"`
+	CurrentStreak int       `json:"current_streak"`
+	LongestStreak int       `json:"longest_streak"`
+	Progress      float64   `json:"progress"`
+	Target        float64   `json:"target"`
+	Completed     bool      `json:"completed"`
+	DoneToday     bool      `json:"done_today"`
+}
+
+// HandleGetSharedHabits lists the habits the caller follows as a partner with
+// their streaks and today's status.
+func (ph *PartnerHandler) HandleGetSharedHabits(w http.ResponseWriter, r *http.Request) {
+	partnerships, err := ph.partnerStore.GetPartnershipsForUser(middleware.GetUser(r).ID, store.PartnerAccepted)
+	if err != nil {
+		ph.logger.Printf("ERROR: getPartnershipsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve shared habits"})
+		return
+	}
+
+	shared := []sharedHabit{}
+	for _, partnership := range partnerships {
+		habit, err := ph.habitStore.GetHabitByID(partnership.HabitID)
+		if err != nil {
+			ph.logger.Printf("ERROR: getHabitByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve shared habits"})
+			return
+		}
+
+		if habit == nil {
+			continue
+		}
+
+		input, err := loadStatsInput(ph.habitStore, habit)
+		if err != nil {
+			ph.logger.Printf("ERROR: loadStatsInput: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve shared habits"})
+			return
+		}
+
+		summary := stats.Compute(input)
+		item := sharedHabit{
+			PartnerID:     partnership.ID,
+			HabitID:       habit.ID,
+			OwnerID:       partnership.OwnerID,
+			Name:          habit.Name,
+			Frequency:     habit.Frequency,
+			CurrentStreak: summary.CurrentStreak,
+			LongestStreak: summary.LongestStreak,
+			Progress:      summary.CurrentProgress,
+			Target:        summary.Target,
+			Completed:     summary.CurrentProgress >= summary.Target,
+		}
+
+		today := stats.Day(input.Now)
+		for _, entry := range input.Entries {
+			if stats.Day(entry.At).Equal(today) {
+				item.DoneToday = true
+				break
+			}
+		}
+
+		shared = append(shared, item)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habits": shared})
+}
+
+// HandleNudgeHabit lets an accepted partner send the habit's owner a nudge.
+func (ph *PartnerHandler) HandleNudgeHabit(w http.ResponseWriter, r *http.Request) {
+	habitID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid habit id"})
+		return
+	}
+
+	var nudgeRequest struct {
+		Message string `json:"message"`
+	}
+
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&nudgeRequest)
+		if err != nil {
+			ph.logger.Printf("ERROR: decodingNudge: %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+			return
+		}
+	}
+
+	habit, err := ph.habitStore.GetHabitByID(habitID)
+	if err != nil {
+		ph.logger.Printf("ERROR: getHabitByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if habit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	isPartner, err := ph.partnerStore.IsPartner(habitID, user.ID)
+	if err != nil {
+		ph.logger.Printf("ERROR: isPartner: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !isPartner || habit.UserID == nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only partners can nudge"})
+		return
+	}
+
+	nudge, err := ph.partnerStore.CreateNudge(&store.Nudge{
+		HabitID:    habitID,
+		FromUserID: user.ID,
+		ToUserID:   *habit.UserID,
+		Message:    nudgeRequest.Message,
+	})
+	if err != nil {
+		ph.logger.Printf("ERROR: createNudge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to send nudge"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"nudge": nudge})
+}
+
+// HandleGetNudges lists the nudges the caller has received.
+func (ph *PartnerHandler) HandleGetNudges(w http.ResponseWriter, r *http.Request) {
+	nudges, err := ph.partnerStore.GetNudges(middleware.GetUser(r).ID)
+	if err != nil {
+		ph.logger.Printf("ERROR: getNudges: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve nudges"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"nudges": nudges})
+}
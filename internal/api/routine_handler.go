@@ -0,0 +1,282 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/stats"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type RoutineHandler struct {
+	routineStore store.RoutineStore
+	habitHandler *HabitHandler
+	logger       *log.Logger
+}
+
+func NewRoutineHandler(routineStore store.RoutineStore, habitHandler *HabitHandler, logger *log.Logger) *RoutineHandler {
+	return &RoutineHandler{
+		routineStore: routineStore,
+		habitHandler: habitHandler,
+		logger:       logger,
+	}
+}
+
+func isRoutineInputError(err error) bool {
+	return err.Error() == "routine habit not found" || err.Error() == "habit listed twice in routine"
+}
+
+func (rh *RoutineHandler) HandleCreateRoutine(w http.ResponseWriter, r *http.Request) {
+	var createRoutineRequest struct {
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+		HabitIDs    []uuid.UUID `json:"habit_ids"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createRoutineRequest)
+	if err != nil {
+		rh.logger.Printf("ERROR: decodingCreateRoutine: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	if createRoutineRequest.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	routine := &store.Routine{
+		UserID:      middleware.GetUser(r).ID,
+		Name:        createRoutineRequest.Name,
+		Description: createRoutineRequest.Description,
+	}
+
+	createdRoutine, err := rh.routineStore.CreateRoutine(routine, createRoutineRequest.HabitIDs)
+	if err != nil {
+		rh.logger.Printf("ERROR: createRoutine: %v", err)
+
+		if isRoutineInputError(err) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create routine"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"routine": createdRoutine})
+}
+
+func (rh *RoutineHandler) HandleGetRoutines(w http.ResponseWriter, r *http.Request) {
+	routines, err := rh.routineStore.GetRoutines(middleware.GetUser(r).ID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutines: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve routines"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"routines": routines})
+}
+
+func (rh *RoutineHandler) HandleGetRoutineByID(w http.ResponseWriter, r *http.Request) {
+	routineID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid routine id"})
+		return
+	}
+
+	routine, err := rh.routineStore.GetRoutineByID(middleware.GetUser(r).ID, routineID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutineByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if routine == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "routine not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"routine": routine})
+}
+
+func (rh *RoutineHandler) HandleUpdateRoutineByID(w http.ResponseWriter, r *http.Request) {
+	routineID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid routine id"})
+		return
+	}
+
+	existingRoutine, err := rh.routineStore.GetRoutineByID(middleware.GetUser(r).ID, routineID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutineByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if existingRoutine == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "routine not found"})
+		return
+	}
+
+	var updateRoutineRequest struct {
+		Name        *string     `json:"name"`
+		Description *string     `json:"description"`
+		HabitIDs    []uuid.UUID `json:"habit_ids"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&updateRoutineRequest)
+	if err != nil {
+		rh.logger.Printf("ERROR: decodingUpdateRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if updateRoutineRequest.Name != nil {
+		existingRoutine.Name = *updateRoutineRequest.Name
+	}
+	if updateRoutineRequest.Description != nil {
+		existingRoutine.Description = *updateRoutineRequest.Description
+	}
+
+	err = rh.routineStore.UpdateRoutine(existingRoutine, updateRoutineRequest.HabitIDs)
+	if err != nil {
+		rh.logger.Printf("ERROR: updatingRoutine: %v", err)
+
+		if isRoutineInputError(err) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	updatedRoutine, err := rh.routineStore.GetRoutineByID(middleware.GetUser(r).ID, routineID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutineByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"routine": updatedRoutine})
+}
+
+func (rh *RoutineHandler) HandleDeleteRoutineByID(w http.ResponseWriter, r *http.Request) {
+	routineID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid routine id"})
+		return
+	}
+
+	err = rh.routineStore.DeleteRoutine(middleware.GetUser(r).ID, routineID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "routine not found"})
+		return
+	}
+
+	if err != nil {
+		rh.logger.Printf("ERROR: deleteRoutine: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting routine"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "routine deleted successfully"})
+}
+
+// HandleGetRoutineProgress shows which steps of a routine are done today and
+// which habit is up next.
+func (rh *RoutineHandler) HandleGetRoutineProgress(w http.ResponseWriter, r *http.Request) {
+	routineID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid routine id"})
+		return
+	}
+
+	routine, err := rh.routineStore.GetRoutineByID(middleware.GetUser(r).ID, routineID)
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutineByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if routine == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "routine not found"})
+		return
+	}
+
+	today := stats.Day(time.Now())
+	steps, err := rh.routineStore.GetRoutineProgress(middleware.GetUser(r).ID, routineID, today, today.AddDate(0, 0, 1))
+	if err != nil {
+		rh.logger.Printf("ERROR: getRoutineProgress: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve routine progress"})
+		return
+	}
+
+	completed := 0
+	var next *store.Habit
+	for _, step := range steps {
+		if step.Completed {
+			completed++
+		} else if next == nil {
+			next = step.Habit
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"steps":     steps,
+		"completed": completed,
+		"total":     len(steps),
+		"next":      next,
+	})
+}
+
+func (rh *RoutineHandler) HandleCompleteRoutine(w http.ResponseWriter, r *http.Request) {
+	routineID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid routine id"})
+		return
+	}
+
+	var completeRequest struct {
+		Note string `json:"note"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&completeRequest)
+	if err != nil && err != io.EOF {
+		rh.logger.Printf("ERROR: decodingCompleteRoutine: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	today := stats.Day(time.Now())
+	entries, err := rh.routineStore.CompleteRoutine(middleware.GetUser(r).ID, routineID, today, today.AddDate(0, 0, 1), completeRequest.Note)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "routine not found"})
+		return
+	}
+
+	if err != nil {
+		rh.logger.Printf("ERROR: completeRoutine: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to complete routine"})
+		return
+	}
+
+	for _, entry := range entries {
+		rh.habitHandler.entryLogged(r, entry)
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habitEntries": entries, "message": "Routine completed successfully"})
+}
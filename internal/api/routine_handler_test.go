@@ -0,0 +1,82 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+)
+
+// fakeRoutineStore completes a single routine owned by owner.
+type fakeRoutineStore struct {
+	store.RoutineStore
+	owner     uuid.UUID
+	routineID uuid.UUID
+	habitIDs  []uuid.UUID
+}
+
+func (f *fakeRoutineStore) CompleteRoutine(userID, id uuid.UUID, from, to time.Time, note string) ([]*store.HabitEntry, error) {
+	if userID != f.owner || id != f.routineID {
+		return nil, sql.ErrNoRows
+	}
+
+	var entries []*store.HabitEntry
+	for _, habitID := range f.habitIDs {
+		entries = append(entries, &store.HabitEntry{ID: uuid.New(), HabitID: habitID, Value: 1, Note: note, CompletedBy: &userID})
+	}
+	return entries, nil
+}
+
+func TestHandleCompleteRoutine(t *testing.T) {
+	owner := &store.User{ID: uuid.New()}
+	stranger := &store.User{ID: uuid.New()}
+	routineStore := &fakeRoutineStore{
+		owner:     owner.ID,
+		routineID: uuid.New(),
+		habitIDs:  []uuid.UUID{uuid.New(), uuid.New()},
+	}
+
+	tests := []struct {
+		name         string
+		user         *store.User
+		want         int
+		wantNotified int
+	}{
+		{"owner completes routine", owner, http.StatusCreated, 2},
+		{"stranger cannot complete routine", stranger, http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hh := NewHabitHandler(&fakeHabitStore{}, &fakePartnerStore{}, &fakeAuditStore{}, log.New(io.Discard, "", 0))
+			var notified []uuid.UUID
+			hh.OnEntryLogged(func(user *store.User, habitID uuid.UUID) {
+				notified = append(notified, habitID)
+			})
+			rh := NewRoutineHandler(routineStore, hh, log.New(io.Discard, "", 0))
+
+			router := chi.NewRouter()
+			router.Post("/routines/{id}/complete", rh.HandleCompleteRoutine)
+
+			req := httptest.NewRequest(http.MethodPost, "/routines/"+routineStore.routineID.String()+"/complete", nil)
+			req = middleware.SetUser(req, tt.user)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+			if len(notified) != tt.wantNotified {
+				t.Errorf("listeners saw %d entries, want %d", len(notified), tt.wantNotified)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type SessionHandler struct {
+	sessionStore store.SessionStore
+	apiKeyStore  store.APIKeyStore
+	logger       *log.Logger
+}
+
+func NewSessionHandler(sessionStore store.SessionStore, apiKeyStore store.APIKeyStore, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+		apiKeyStore:  apiKeyStore,
+		logger:       logger,
+	}
+}
+
+// HandleGetSessions lists the user's signed-in sessions and API keys. Last
+// used times are written in batches, so they can lag by up to a minute.
+func (sh *SessionHandler) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUser(r).ID
+
+	sessions, err := sh.sessionStore.GetSessions(userID)
+	if err != nil {
+		sh.logger.Printf("ERROR: getSessions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve sessions"})
+		return
+	}
+
+	keys, err := sh.apiKeyStore.GetAPIKeys(userID)
+	if err != nil {
+		sh.logger.Printf("ERROR: getAPIKeys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve sessions"})
+		return
+	}
+
+	response := utils.Envelope{"sessions": sessions, "api_keys": keys}
+
+	tokenHash := middleware.GetTokenHash(r)
+	for _, session := range sessions {
+		if session.UsesToken(tokenHash) {
+			response["current_session_id"] = session.ID
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (sh *SessionHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid session id"})
+		return
+	}
+
+	err = sh.sessionStore.RevokeSession(sessionID, middleware.GetUser(r).ID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "session not found"})
+		return
+	}
+
+	if err != nil {
+		sh.logger.Printf("ERROR: revokeSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error revoking session"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "session revoked successfully"})
+}
+
+// HandleRevokeAllSessions logs the user out everywhere. With
+// ?keep_current=true the session making the request survives. API keys are
+// left alone; they are revoked one at a time.
+func (sh *SessionHandler) HandleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	var keep []byte
+	if r.URL.Query().Get("keep_current") == "true" {
+		keep = middleware.GetTokenHash(r)
+	}
+
+	revoked, err := sh.sessionStore.RevokeAllSessions(middleware.GetUser(r).ID, keep)
+	if err != nil {
+		sh.logger.Printf("ERROR: revokeAllSessions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error revoking sessions"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "signed out everywhere", "revoked": revoked})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type SyncHandler struct {
+	syncStore store.SyncStore
+	logger    *log.Logger
+}
+
+func NewSyncHandler(syncStore store.SyncStore, logger *log.Logger) *SyncHandler {
+	return &SyncHandler{
+		syncStore: syncStore,
+		logger:    logger,
+	}
+}
+
+func (sh *SyncHandler) HandleGetChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := store.DecodeChangeToken(r.URL.Query().Get("since"))
+	if err != nil {
+		sh.logger.Printf("ERROR: decodeChangeToken: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid change token"})
+		return
+	}
+
+	changes, err := sh.syncStore.GetChangesSince(middleware.GetUser(r).ID, since)
+	if err != nil {
+		sh.logger.Printf("ERROR: getChangesSince: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve changes"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"habits":  changes.Habits,
+		"tags":    changes.Tags,
+		"entries": changes.Entries,
+		"journal": changes.Journal,
+		"deleted": changes.Deleted,
+		"reset":   changes.Reset,
+		"token":   store.EncodeChangeToken(changes.Version),
+	})
+}
+
+func (sh *SyncHandler) HandleApplyMutations(w http.ResponseWriter, r *http.Request) {
+	var syncRequest struct {
+		Mutations []store.SyncMutation `json:"mutations"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&syncRequest)
+	if err != nil {
+		sh.logger.Printf("ERROR: decodingSyncRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	results, err := sh.syncStore.ApplyMutations(middleware.GetUser(r).ID, syncRequest.Mutations)
+	if err != nil {
+		sh.logger.Printf("ERROR: applyMutations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to apply mutations"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"results": results})
+}
@@ -12,12 +12,14 @@ import (
 
 type TagHandler struct {
 	tagStore store.TagStore
+	audit    *auditor
 	logger   *log.Logger
 }
 
-func NewTagHandler(tagStore store.TagStore, logger *log.Logger) *TagHandler {
+func NewTagHandler(tagStore store.TagStore, auditStore store.AuditStore, logger *log.Logger) *TagHandler {
 	return &TagHandler{
 		tagStore: tagStore,
+		audit:    &auditor{auditStore: auditStore, logger: logger},
 		logger:   logger,
 	}
 }
@@ -45,6 +47,8 @@ func (th *TagHandler) HandleCreateTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	th.audit.record(r, auditCreate, "tag", createdTag.ID, nil, createdTag)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"tag": createdTag})
 }
 
@@ -96,6 +100,8 @@ func (th *TagHandler) HandleUpdateTagByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before := *existingTag
+
 	var updateTagRequest struct {
 		Name  *string `json:"name"`
 		Color *string `json:"color"`
@@ -122,6 +128,8 @@ func (th *TagHandler) HandleUpdateTagByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	th.audit.record(r, auditUpdate, "tag", tagID, &before, existingTag)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tag": existingTag})
 }
 
@@ -132,6 +140,13 @@ func (th *TagHandler) HandleDeleteTagByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	before, err := th.tagStore.GetTagByID(tagID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTagByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting tag"})
+		return
+	}
+
 	err = th.tagStore.DeleteTag(tagID)
 	if err == sql.ErrNoRows {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "tag not found"})
@@ -143,5 +158,45 @@ func (th *TagHandler) HandleDeleteTagByID(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	th.audit.record(r, auditDelete, "tag", tagID, before, nil)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "tag deleted successfully"})
 }
+
+func (th *TagHandler) HandleRestoreTagByID(w http.ResponseWriter, r *http.Request) {
+	tagID, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("ERROR: readIDParam: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid tag id"})
+		return
+	}
+
+	err = th.tagStore.RestoreTag(tagID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "tag not found in trash"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: restoreTag: %v", err)
+
+		if err.Error() == "tag with this name already exists" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "tag with this name already exists"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "error restoring tag"})
+		return
+	}
+
+	tag, err := th.tagStore.GetTagByID(tagID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTagByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	th.audit.record(r, auditUpdate, "tag", tagID, nil, tag)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"tag": tag})
+}
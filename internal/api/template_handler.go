@@ -0,0 +1,125 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	logger        *log.Logger
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, logger *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		logger:        logger,
+	}
+}
+
+func (th *TemplateHandler) HandleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	templates, err := th.templateStore.GetTemplates(user.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTemplates: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve templates"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+// HandleCreateTemplate saves one of the user's habits as a private template.
+func (th *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	var createTemplateRequest struct {
+		HabitID uuid.UUID `json:"habit_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&createTemplateRequest)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingCreateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		return
+	}
+
+	template, err := th.templateStore.SaveHabitAsTemplate(user.ID, createTemplateRequest.HabitID)
+	if err != nil {
+		th.logger.Printf("ERROR: saveHabitAsTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create template"})
+		return
+	}
+
+	if template == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "habit not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": template})
+}
+
+func (th *TemplateHandler) HandleDeleteTemplateByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	templateID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "only private templates can be deleted"})
+		return
+	}
+
+	err = th.templateStore.DeleteTemplate(user.ID, templateID)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"message": "template not found"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: deleteTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error deleting template"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "template deleted successfully"})
+}
+
+// HandleInstantiateTemplate creates a habit from a template, along with any
+// of its suggested tags that don't exist yet.
+func (th *TemplateHandler) HandleInstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	template, err := th.templateStore.GetTemplateByID(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		th.logger.Printf("ERROR: getTemplateByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if template == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return
+	}
+
+	var ownerID *uuid.UUID
+	if !user.IsAnonymous() {
+		ownerID = &user.ID
+	}
+
+	habit, tags, err := th.templateStore.InstantiateTemplate(template, ownerID)
+	if err != nil {
+		th.logger.Printf("ERROR: instantiateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create habit"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"habit": habit, "tags": tags})
+}
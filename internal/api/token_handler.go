@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const twoFactorChallengeTTL = 5 * time.Minute
+
+type TokenHandler struct {
+	tokenStore store.TokenStore
+	userStore  store.UserStore
+	twoFactor  *twoFactorVerifier
+	logger     *log.Logger
+}
+
+// createTokenRequest is either a username and password, optionally with a
+// second factor code, or the challenge token from an earlier password step
+// together with the code.
+type createTokenRequest struct {
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Code           string `json:"code"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, twoFactorStore store.TwoFactorStore, logger *log.Logger) *TokenHandler {
+	return &TokenHandler{
+		tokenStore: tokenStore,
+		userStore:  userStore,
+		twoFactor:  &twoFactorVerifier{twoFactorStore: twoFactorStore, now: time.Now},
+		logger:     logger,
+	}
+}
+
+func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingCreateToken: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.ChallengeToken != "" {
+		th.completeTwoFactorLogin(w, &req)
+		return
+	}
+
+	user, err := th.userStore.GetUserByUsername(req.Username)
+	if err != nil {
+		th.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	passwordsDoMatch, err := user.PasswordHash.Matches(req.Password)
+	if err != nil {
+		th.logger.Printf("ERROR: passwordMatches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !passwordsDoMatch {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this account has been deactivated"})
+		return
+	}
+
+	tf, err := th.twoFactor.requiresTwoFactor(user.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: requiresTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if tf == nil {
+		th.issueAuthToken(w, user)
+		return
+	}
+
+	if req.Code != "" {
+		th.checkSecondFactor(w, user, tf, req.Code)
+		return
+	}
+
+	challenge, err := th.tokenStore.CreateNewToken(user.ID, twoFactorChallengeTTL, tokens.ScopeTwoFactor)
+	if err != nil {
+		th.logger.Printf("ERROR: createNewToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{
+		"two_factor_required": true,
+		"challenge_token":     challenge.Plaintext,
+		"expiry":              challenge.Expiry,
+	})
+}
+
+// completeTwoFactorLogin is the second step of a login with 2FA. The
+// challenge token is spent whether or not the code is right, so each
+// password entry gets one guess.
+func (th *TokenHandler) completeTwoFactorLogin(w http.ResponseWriter, req *createTokenRequest) {
+	if req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	user, err := th.userStore.GetUserToken(tokens.ScopeTwoFactor, req.ChallengeToken)
+	if err != nil {
+		th.logger.Printf("ERROR: getUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired challenge token"})
+		return
+	}
+
+	err = th.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeTwoFactor)
+	if err != nil {
+		th.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	tf, err := th.twoFactor.requiresTwoFactor(user.ID)
+	if err != nil {
+		th.logger.Printf("ERROR: requiresTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// 2FA was turned off between the two steps; the password was still right.
+	if tf == nil {
+		th.issueAuthToken(w, user)
+		return
+	}
+
+	th.checkSecondFactor(w, user, tf, req.Code)
+}
+
+func (th *TokenHandler) checkSecondFactor(w http.ResponseWriter, user *store.User, tf *store.TwoFactor, code string) {
+	ok, err := th.twoFactor.verify(tf, code)
+	if err != nil {
+		th.logger.Printf("ERROR: verifyTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+
+	th.issueAuthToken(w, user)
+}
+
+func (th *TokenHandler) issueAuthToken(w http.ResponseWriter, user *store.User) {
+	token, err := th.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		th.logger.Printf("ERROR: createNewToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token})
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/totp"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// fakeTwoFactorStore holds one user's enrolment and recovery codes.
+type fakeTwoFactorStore struct {
+	store.TwoFactorStore
+	tf *store.TwoFactor
+	// recoveryCodes maps a normalised code to whether it has been used.
+	recoveryCodes map[string]bool
+}
+
+func (f *fakeTwoFactorStore) GetTwoFactor(userID uuid.UUID) (*store.TwoFactor, error) {
+	if f.tf == nil || f.tf.UserID != userID {
+		return nil, nil
+	}
+	return f.tf, nil
+}
+
+func (f *fakeTwoFactorStore) RecordStep(userID uuid.UUID, step int64) (bool, error) {
+	if f.tf.LastStep != nil && *f.tf.LastStep >= step {
+		return false, nil
+	}
+	f.tf.LastStep = &step
+	return true, nil
+}
+
+func (f *fakeTwoFactorStore) UseRecoveryCode(userID uuid.UUID, code string) (bool, error) {
+	used, ok := f.recoveryCodes[code]
+	if !ok || used {
+		return false, nil
+	}
+	f.recoveryCodes[code] = true
+	return true, nil
+}
+
+func (f *fakeUserStore) GetUserByUsername(username string) (*store.User, error) {
+	for _, user := range f.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func newTwoFactorStore(userID uuid.UUID) *fakeTwoFactorStore {
+	enabledAt := time.Now()
+	return &fakeTwoFactorStore{
+		tf:            &store.TwoFactor{UserID: userID, Secret: testTOTPSecret, EnabledAt: &enabledAt},
+		recoveryCodes: map[string]bool{"abcdefghijklmnop": false},
+	}
+}
+
+func totpCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totp.Code(testTOTPSecret, totp.Step(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTwoFactorVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	userID := uuid.New()
+
+	// Each case runs its codes in order against a fresh enrolment.
+	tests := []struct {
+		name  string
+		codes []string
+		want  []bool
+	}{
+		{"current code", []string{totpCode(t, now)}, []bool{true}},
+		{"previous step within drift", []string{totpCode(t, now.Add(-totp.Period))}, []bool{true}},
+		{"next step within drift", []string{totpCode(t, now.Add(totp.Period))}, []bool{true}},
+		{"outside drift window", []string{totpCode(t, now.Add(-2*totp.Period))}, []bool{false}},
+		{"replayed code", []string{totpCode(t, now), totpCode(t, now)}, []bool{true, false}},
+		{"older step after newer", []string{totpCode(t, now), totpCode(t, now.Add(-totp.Period))}, []bool{true, false}},
+		{"wrong code", []string{"000000"}, []bool{false}},
+		{"recovery code once", []string{"abcd-efgh-ijkl-mnop", "abcdefghijklmnop"}, []bool{true, false}},
+		{"unknown recovery code", []string{"zzzz-zzzz-zzzz-zzzz"}, []bool{false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			twoFactorStore := newTwoFactorStore(userID)
+			verifier := &twoFactorVerifier{twoFactorStore: twoFactorStore, now: func() time.Time { return now }}
+
+			for i, code := range tt.codes {
+				ok, err := verifier.verify(twoFactorStore.tf, code)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != tt.want[i] {
+					t.Errorf("code %d (%s): ok = %v, want %v", i, code, ok, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTwoStepLogin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	user := &store.User{ID: uuid.New(), Username: "ada", Email: "ada@example.com"}
+	err := user.PasswordHash.Set("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setup := func() (*TokenHandler, *fakeTokenStore) {
+		tokenStore := &fakeTokenStore{tokens: map[string]*tokens.Token{}}
+		userStore := &fakeUserStore{users: map[uuid.UUID]*store.User{user.ID: user}, tokenStore: tokenStore}
+
+		th := NewTokenHandler(tokenStore, userStore, newTwoFactorStore(user.ID), log.New(io.Discard, "", 0))
+		th.twoFactor.now = func() time.Time { return now }
+		return th, tokenStore
+	}
+
+	login := func(th *TokenHandler, body string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		th.HandleCreateToken(rec, httptest.NewRequest(http.MethodPost, "/tokens/authentication", strings.NewReader(body)))
+
+		var response map[string]any
+		err := json.Unmarshal(rec.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("decoding response %s: %v", rec.Body, err)
+		}
+		return rec.Code, response
+	}
+
+	challenge := func(th *TokenHandler) string {
+		status, response := login(th, `{"username": "ada", "password": "correct horse"}`)
+		if status != http.StatusAccepted || response["two_factor_required"] != true {
+			t.Fatalf("password step = %d %v, want a 2FA challenge", status, response)
+		}
+		return response["challenge_token"].(string)
+	}
+
+	t.Run("password then code", func(t *testing.T) {
+		th, tokenStore := setup()
+		token := challenge(th)
+
+		status, response := login(th, `{"challenge_token": "`+token+`", "code": "`+totpCode(t, now)+`"}`)
+		if status != http.StatusCreated || response["auth_token"] == nil {
+			t.Fatalf("code step = %d %v, want an auth token", status, response)
+		}
+		for _, stored := range tokenStore.tokens {
+			if stored.Scope == tokens.ScopeTwoFactor {
+				t.Error("challenge token was not spent")
+			}
+		}
+	})
+
+	t.Run("password and code together", func(t *testing.T) {
+		th, _ := setup()
+		status, _ := login(th, `{"username": "ada", "password": "correct horse", "code": "`+totpCode(t, now)+`"}`)
+		if status != http.StatusCreated {
+			t.Errorf("status = %d, want %d", status, http.StatusCreated)
+		}
+	})
+
+	t.Run("wrong password never reaches the second step", func(t *testing.T) {
+		th, tokenStore := setup()
+		status, _ := login(th, `{"username": "ada", "password": "wrong horse"}`)
+		if status != http.StatusUnauthorized || len(tokenStore.tokens) != 0 {
+			t.Errorf("status = %d with %d tokens, want 401 and none", status, len(tokenStore.tokens))
+		}
+	})
+
+	t.Run("challenge allows one guess", func(t *testing.T) {
+		th, _ := setup()
+		token := challenge(th)
+
+		status, _ := login(th, `{"challenge_token": "`+token+`", "code": "000000"}`)
+		if status != http.StatusUnauthorized {
+			t.Fatalf("wrong code status = %d, want %d", status, http.StatusUnauthorized)
+		}
+
+		status, _ = login(th, `{"challenge_token": "`+token+`", "code": "`+totpCode(t, now)+`"}`)
+		if status != http.StatusUnauthorized {
+			t.Errorf("reused challenge status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("code is not accepted twice", func(t *testing.T) {
+		th, _ := setup()
+		code := totpCode(t, now)
+
+		status, _ := login(th, `{"challenge_token": "`+challenge(th)+`", "code": "`+code+`"}`)
+		if status != http.StatusCreated {
+			t.Fatalf("first login status = %d, want %d", status, http.StatusCreated)
+		}
+
+		status, _ = login(th, `{"challenge_token": "`+challenge(th)+`", "code": "`+code+`"}`)
+		if status != http.StatusUnauthorized {
+			t.Errorf("replayed code status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("recovery code signs in once", func(t *testing.T) {
+		th, _ := setup()
+
+		status, _ := login(th, `{"challenge_token": "`+challenge(th)+`", "code": "ABCD-EFGH-IJKL-MNOP"}`)
+		if status != http.StatusCreated {
+			t.Fatalf("first use status = %d, want %d", status, http.StatusCreated)
+		}
+
+		status, _ = login(th, `{"challenge_token": "`+challenge(th)+`", "code": "ABCD-EFGH-IJKL-MNOP"}`)
+		if status != http.StatusUnauthorized {
+			t.Errorf("second use status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("expired challenge", func(t *testing.T) {
+		th, tokenStore := setup()
+		token := challenge(th)
+		tokenStore.tokens[string(tokens.Hash(token))].Expiry = time.Now().Add(-time.Second)
+
+		status, _ := login(th, `{"challenge_token": "`+token+`", "code": "`+totpCode(t, now)+`"}`)
+		if status != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", status, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type TrashHandler struct {
+	trashStore store.TrashStore
+	logger     *log.Logger
+}
+
+func NewTrashHandler(trashStore store.TrashStore, logger *log.Logger) *TrashHandler {
+	return &TrashHandler{
+		trashStore: trashStore,
+		logger:     logger,
+	}
+}
+
+func (th *TrashHandler) HandleGetTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := th.trashStore.GetTrash(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTrash: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to retrieve trash"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"habits": trash.Habits, "tags": trash.Tags})
+}
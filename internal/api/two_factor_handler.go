@@ -0,0 +1,290 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/totp"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const (
+	totpIssuer         = "Habit Tracker"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 16
+)
+
+// twoFactorVerifier checks second factors for both the 2FA settings routes
+// and login. now is swapped for a fixed clock in tests.
+type twoFactorVerifier struct {
+	twoFactorStore store.TwoFactorStore
+	now            func() time.Time
+}
+
+// verify accepts either a current TOTP code or an unused recovery code, and
+// refuses a TOTP code that has been used before.
+func (v *twoFactorVerifier) verify(tf *store.TwoFactor, code string) (bool, error) {
+	step, ok := totp.Validate(tf.Secret, code, v.now())
+	if ok {
+		return v.twoFactorStore.RecordStep(tf.UserID, step)
+	}
+
+	recoveryCode := normalizeRecoveryCode(code)
+	if len(recoveryCode) != recoveryCodeLength {
+		return false, nil
+	}
+
+	return v.twoFactorStore.UseRecoveryCode(tf.UserID, recoveryCode)
+}
+
+// requiresTwoFactor loads the user's enrolment when 2FA is enabled for them,
+// and nil otherwise.
+func (v *twoFactorVerifier) requiresTwoFactor(userID uuid.UUID) (*store.TwoFactor, error) {
+	tf, err := v.twoFactorStore.GetTwoFactor(userID)
+	if err != nil || !tf.Enabled() {
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+// generateRecoveryCodes returns codes for the user to write down, formatted
+// in groups of four, and the normalised form that gets hashed and stored.
+func generateRecoveryCodes() (display []string, stored []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for range recoveryCodeCount {
+		randomBytes := make([]byte, 10)
+		_, err = rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(randomBytes))
+		stored = append(stored, code)
+		display = append(display, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+	}
+
+	return display, stored, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+type TwoFactorHandler struct {
+	verifier *twoFactorVerifier
+	logger   *log.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, logger *log.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		verifier: &twoFactorVerifier{twoFactorStore: twoFactorStore, now: time.Now},
+		logger:   logger,
+	}
+}
+
+func (th *TwoFactorHandler) HandleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUser(r).ID
+
+	tf, err := th.verifier.twoFactorStore.GetTwoFactor(userID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	response := utils.Envelope{"enabled": tf.Enabled()}
+	if tf.Enabled() {
+		remaining, err := th.verifier.twoFactorStore.CountRecoveryCodes(userID)
+		if err != nil {
+			th.logger.Printf("ERROR: countRecoveryCodes: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		response["enabled_at"] = tf.EnabledAt
+		response["recovery_codes_remaining"] = remaining
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// HandleEnrollTwoFactor starts enrolment with a fresh secret. 2FA isn't
+// enforced until the user confirms a code with HandleConfirmTwoFactor.
+func (th *TwoFactorHandler) HandleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		th.logger.Printf("ERROR: generateSecret: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = th.verifier.twoFactorStore.StartEnrolment(user.ID, secret)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: startEnrolment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// readCode decodes the request's code and loads the user's enrolment,
+// writing the error response and returning nil when either is missing.
+// enabled says which state the enrolment has to be in.
+func (th *TwoFactorHandler) readCode(w http.ResponseWriter, r *http.Request, enabled bool) (*store.TwoFactor, string) {
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("ERROR: decodingTwoFactorCode: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return nil, ""
+	}
+
+	if req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return nil, ""
+	}
+
+	tf, err := th.verifier.twoFactorStore.GetTwoFactor(middleware.GetUser(r).ID)
+	if err != nil {
+		th.logger.Printf("ERROR: getTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, ""
+	}
+
+	switch {
+	case tf == nil && !enabled:
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "start enrolment first"})
+		return nil, ""
+	case !tf.Enabled() && enabled:
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return nil, ""
+	case tf.Enabled() && !enabled:
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return nil, ""
+	}
+
+	return tf, req.Code
+}
+
+// HandleConfirmTwoFactor enables 2FA once the user proves their app produces
+// valid codes, and returns the recovery codes. They are only shown here.
+func (th *TwoFactorHandler) HandleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	tf, code := th.readCode(w, r, false)
+	if tf == nil {
+		return
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, th.verifier.now())
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	display, stored, err := generateRecoveryCodes()
+	if err != nil {
+		th.logger.Printf("ERROR: generateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	_, err = th.verifier.twoFactorStore.RecordStep(tf.UserID, step)
+	if err != nil {
+		th.logger.Printf("ERROR: recordStep: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = th.verifier.twoFactorStore.EnableTwoFactor(tf.UserID, stored)
+	if err != nil {
+		th.logger.Printf("ERROR: enableTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"enabled": true, "recovery_codes": display})
+}
+
+// HandleRegenerateRecoveryCodes replaces every recovery code. It needs a
+// current code so a stolen session alone can't take over the second factor.
+func (th *TwoFactorHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	tf, code := th.readCode(w, r, true)
+	if tf == nil || !th.checkCode(w, tf, code) {
+		return
+	}
+
+	display, stored, err := generateRecoveryCodes()
+	if err != nil {
+		th.logger.Printf("ERROR: generateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = th.verifier.twoFactorStore.ReplaceRecoveryCodes(tf.UserID, stored)
+	if err != nil {
+		th.logger.Printf("ERROR: replaceRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": display})
+}
+
+func (th *TwoFactorHandler) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	tf, code := th.readCode(w, r, true)
+	if tf == nil || !th.checkCode(w, tf, code) {
+		return
+	}
+
+	err := th.verifier.twoFactorStore.DisableTwoFactor(tf.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		th.logger.Printf("ERROR: disableTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"message": "error disabling two-factor authentication"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "two-factor authentication disabled"})
+}
+
+// checkCode verifies a code for an enabled enrolment, writing the error
+// response when it doesn't match.
+func (th *TwoFactorHandler) checkCode(w http.ResponseWriter, tf *store.TwoFactor, code string) bool {
+	ok, err := th.verifier.verify(tf, code)
+	if err != nil {
+		th.logger.Printf("ERROR: verifyTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "invalid code"})
+		return false
+	}
+
+	return true
+}
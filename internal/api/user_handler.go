@@ -0,0 +1,347 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/notify"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+const (
+	activationTokenTTL    = 72 * time.Hour
+	passwordResetTokenTTL = 45 * time.Minute
+)
+
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+type registerUserRequest struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type UserHandler struct {
+	userStore   store.UserStore
+	tokenStore  store.TokenStore
+	apiKeyStore store.APIKeyStore
+	notifier    notify.Notifier
+	logger      *log.Logger
+}
+
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, apiKeyStore store.APIKeyStore, notifier notify.Notifier, logger *log.Logger) *UserHandler {
+	return &UserHandler{
+		userStore:   userStore,
+		tokenStore:  tokenStore,
+		apiKeyStore: apiKeyStore,
+		notifier:    notifier,
+		logger:      logger,
+	}
+}
+
+func (uh *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
+	if req.Username == "" {
+		return errors.New("username is required")
+	}
+
+	if len(req.Username) > 50 {
+		return errors.New("username cannot be greater than 50 characters")
+	}
+
+	if req.Email == "" {
+		return errors.New("email is required")
+	}
+
+	if !emailRegex.MatchString(req.Email) {
+		return errors.New("invalid email format")
+	}
+
+	if len(req.Password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+
+	return nil
+}
+
+func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
+	var req registerUserRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingRegisterUser: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = uh.validateRegisterRequest(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user := &store.User{
+		Username:  req.Username,
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	}
+
+	err = user.PasswordHash.Set(req.Password)
+	if err != nil {
+		uh.logger.Printf("ERROR: hashingPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.userStore.CreateUser(user)
+	if err != nil {
+		uh.logger.Printf("ERROR: createUser: %v", err)
+
+		if err.Error() == "username or email already taken" {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to register user"})
+		return
+	}
+
+	// The account exists either way; a lost email can be resent later.
+	err = uh.sendVerification(user)
+	if err != nil {
+		uh.logger.Printf("ERROR: sendVerification: %v", err)
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
+}
+
+// sendVerification issues an activation token and sends it to the user's
+// email address.
+func (uh *UserHandler) sendVerification(user *store.User) error {
+	token, err := uh.tokenStore.CreateNewToken(user.ID, activationTokenTTL, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	return uh.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse this token to verify your email address:\n\n%s\n\nIt expires at %s.", user.Username, token.Plaintext, token.Expiry.Format(time.RFC1123)),
+		Secret:  token.Plaintext,
+	})
+}
+
+// HandleResendVerification sends a fresh verification email to the signed-in
+// user. Earlier tokens stay valid until they expire.
+func (uh *UserHandler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsVerified() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "email address is already verified"})
+		return
+	}
+
+	err := uh.sendVerification(user)
+	if err != nil {
+		uh.logger.Printf("ERROR: sendVerification: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to send verification email"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": "verification email sent"})
+}
+
+func (uh *UserHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verifyEmailRequest struct {
+		Token string `json:"token"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&verifyEmailRequest)
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingVerifyEmail: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	user := uh.consumeToken(w, tokens.ScopeActivation, verifyEmailRequest.Token)
+	if user == nil {
+		return
+	}
+
+	err = uh.userStore.SetEmailVerified(user.ID)
+	if err != nil {
+		uh.logger.Printf("ERROR: setEmailVerified: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user, err = uh.userStore.GetUserByID(user.ID)
+	if err != nil {
+		uh.logger.Printf("ERROR: getUserByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// consumeToken resolves a single-use token and deletes every token of that
+// scope for its owner, so it can't be replayed. It writes the error response
+// and returns nil when the token is unknown or expired.
+func (uh *UserHandler) consumeToken(w http.ResponseWriter, scope, plaintext string) *store.User {
+	if plaintext == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return nil
+	}
+
+	user, err := uh.userStore.GetUserToken(scope, plaintext)
+	if err != nil {
+		uh.logger.Printf("ERROR: getUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired token"})
+		return nil
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, scope)
+	if err != nil {
+		uh.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	return user
+}
+
+// HandleRequestPasswordReset emails a reset token to the account with the
+// given address. It answers the same way whether or not the account exists so
+// it can't be used to discover registered emails.
+func (uh *UserHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var passwordResetRequest struct {
+		Email string `json:"email"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&passwordResetRequest)
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingPasswordReset: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !emailRegex.MatchString(passwordResetRequest.Email) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email format"})
+		return
+	}
+
+	response := utils.Envelope{"message": "if an account with that email exists, a password reset token has been sent"}
+
+	user, err := uh.userStore.GetUserByEmail(passwordResetRequest.Email)
+	if err != nil {
+		uh.logger.Printf("ERROR: getUserByEmail: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil || user.DeactivatedAt != nil {
+		utils.WriteJSON(w, http.StatusAccepted, response)
+		return
+	}
+
+	token, err := uh.tokenStore.CreateNewToken(user.ID, passwordResetTokenTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		uh.logger.Printf("ERROR: createNewToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.notifier.Send(notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse this token to reset your password:\n\n%s\n\nIt expires at %s. If you didn't ask for a reset you can ignore this email.", user.Username, token.Plaintext, token.Expiry.Format(time.RFC1123)),
+		Secret:  token.Plaintext,
+	})
+	if err != nil {
+		uh.logger.Printf("ERROR: sendPasswordReset: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to send password reset email"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// HandleResetPassword sets a new password using a token from
+// HandleRequestPasswordReset, signs the user out everywhere and revokes their
+// API keys. Receiving the token also proves the user owns their email
+// address.
+func (uh *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetPasswordRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&resetPasswordRequest)
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingResetPassword: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if len(resetPasswordRequest.Password) < 8 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password must be at least 8 characters"})
+		return
+	}
+
+	user := uh.consumeToken(w, tokens.ScopePasswordReset, resetPasswordRequest.Token)
+	if user == nil {
+		return
+	}
+
+	err = user.PasswordHash.Set(resetPasswordRequest.Password)
+	if err != nil {
+		uh.logger.Printf("ERROR: hashingPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.userStore.UpdatePassword(user)
+	if err != nil {
+		uh.logger.Printf("ERROR: updatePassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeAuth)
+	if err != nil {
+		uh.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.apiKeyStore.DeleteAllAPIKeysForUser(user.ID)
+	if err != nil {
+		uh.logger.Printf("ERROR: deleteAllAPIKeysForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !user.IsVerified() {
+		err = uh.userStore.SetEmailVerified(user.ID)
+		if err != nil {
+			uh.logger.Printf("ERROR: setEmailVerified: %v", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password reset successfully"})
+}
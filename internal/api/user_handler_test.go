@@ -0,0 +1,218 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/notify"
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+// fakeTokenStore keeps tokens in memory, keyed by their hash.
+type fakeTokenStore struct {
+	store.TokenStore
+	tokens map[string]*tokens.Token
+}
+
+func (f *fakeTokenStore) CreateNewToken(userID uuid.UUID, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	f.tokens[string(token.Hash)] = token
+	return token, nil
+}
+
+func (f *fakeTokenStore) DeleteAllTokensForUser(userID uuid.UUID, scope string) error {
+	for hash, token := range f.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(f.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// fakeUserStore serves users from memory and looks tokens up in tokenStore.
+type fakeUserStore struct {
+	store.UserStore
+	users      map[uuid.UUID]*store.User
+	tokenStore *fakeTokenStore
+}
+
+func (f *fakeUserStore) GetUserByEmail(email string) (*store.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserStore) GetUserToken(scope, tokenPlaintext string) (*store.User, error) {
+	token := f.tokenStore.tokens[string(tokens.Hash(tokenPlaintext))]
+	if token == nil || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, nil
+	}
+	return f.users[token.UserID], nil
+}
+
+func (f *fakeUserStore) UpdatePassword(user *store.User) error {
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUserStore) SetEmailVerified(id uuid.UUID) error {
+	now := time.Now()
+	f.users[id].EmailVerifiedAt = &now
+	return nil
+}
+
+type fakeAPIKeyStore struct {
+	store.APIKeyStore
+	revoked []uuid.UUID
+}
+
+func (f *fakeAPIKeyStore) DeleteAllAPIKeysForUser(userID uuid.UUID) error {
+	f.revoked = append(f.revoked, userID)
+	return nil
+}
+
+// fakeNotifier records messages instead of delivering them.
+type fakeNotifier struct {
+	sent []notify.Message
+}
+
+func (f *fakeNotifier) Send(msg notify.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	user := &store.User{ID: uuid.New(), Username: "ada", Email: "ada@example.com"}
+
+	type fixture struct {
+		handler     *UserHandler
+		tokenStore  *fakeTokenStore
+		userStore   *fakeUserStore
+		apiKeyStore *fakeAPIKeyStore
+		notifier    *fakeNotifier
+	}
+
+	setup := func(t *testing.T) *fixture {
+		tokenStore := &fakeTokenStore{tokens: map[string]*tokens.Token{}}
+		userStore := &fakeUserStore{
+			users:      map[uuid.UUID]*store.User{user.ID: {ID: user.ID, Username: user.Username, Email: user.Email}},
+			tokenStore: tokenStore,
+		}
+		apiKeyStore := &fakeAPIKeyStore{}
+		notifier := &fakeNotifier{}
+
+		_, err := tokenStore.CreateNewToken(user.ID, time.Hour, tokens.ScopeAuth)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := NewUserHandler(userStore, tokenStore, apiKeyStore, notifier, log.New(io.Discard, "", 0))
+		return &fixture{handler, tokenStore, userStore, apiKeyStore, notifier}
+	}
+
+	request := func(f *fixture) string {
+		rec := httptest.NewRecorder()
+		f.handler.HandleRequestPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/users/password-reset", strings.NewReader(`{"email": "ada@example.com"}`)))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("request status = %d, want %d (body %s)", rec.Code, http.StatusAccepted, rec.Body)
+		}
+		if len(f.notifier.sent) != 1 {
+			t.Fatalf("sent %d messages, want 1", len(f.notifier.sent))
+		}
+		return f.notifier.sent[0].Secret
+	}
+
+	reset := func(f *fixture, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		body := `{"token": "` + token + `", "password": "correct horse"}`
+		f.handler.HandleResetPassword(rec, httptest.NewRequest(http.MethodPut, "/users/password", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("issue", func(t *testing.T) {
+		f := setup(t)
+		secret := request(f)
+
+		msg := f.notifier.sent[0]
+		if msg.To != user.Email {
+			t.Errorf("sent to %q, want %q", msg.To, user.Email)
+		}
+		if secret == "" || !strings.Contains(msg.Body, secret) {
+			t.Errorf("message %+v does not carry its secret", msg)
+		}
+	})
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		f := setup(t)
+		rec := httptest.NewRecorder()
+		f.handler.HandleRequestPasswordReset(rec, httptest.NewRequest(http.MethodPost, "/users/password-reset", strings.NewReader(`{"email": "nobody@example.com"}`)))
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusAccepted)
+		}
+		if len(f.notifier.sent) != 0 {
+			t.Errorf("sent %d messages, want none", len(f.notifier.sent))
+		}
+	})
+
+	t.Run("consume", func(t *testing.T) {
+		f := setup(t)
+		rec := reset(f, request(f))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusOK, rec.Body)
+		}
+
+		matches, err := f.userStore.users[user.ID].PasswordHash.Matches("correct horse")
+		if err != nil || !matches {
+			t.Errorf("password was not updated (err %v)", err)
+		}
+		if len(f.tokenStore.tokens) != 0 {
+			t.Errorf("%d tokens left, want sessions and the reset token gone", len(f.tokenStore.tokens))
+		}
+		if len(f.apiKeyStore.revoked) != 1 || f.apiKeyStore.revoked[0] != user.ID {
+			t.Errorf("revoked API keys for %v, want %v", f.apiKeyStore.revoked, user.ID)
+		}
+		if !f.userStore.users[user.ID].IsVerified() {
+			t.Error("reset did not verify the email address")
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		f := setup(t)
+		secret := request(f)
+		f.tokenStore.tokens[string(tokens.Hash(secret))].Expiry = time.Now().Add(-time.Minute)
+
+		rec := reset(f, secret)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		if len(f.apiKeyStore.revoked) != 0 {
+			t.Error("expired token revoked API keys")
+		}
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		f := setup(t)
+		secret := request(f)
+
+		if rec := reset(f, secret); rec.Code != http.StatusOK {
+			t.Fatalf("first reset status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		if rec := reset(f, secret); rec.Code != http.StatusBadRequest {
+			t.Errorf("second reset status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
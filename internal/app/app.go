@@ -6,20 +6,58 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/kevin120202/habit-tracker/internal/achievements"
 	"github.com/kevin120202/habit-tracker/internal/api"
+	"github.com/kevin120202/habit-tracker/internal/middleware"
+	"github.com/kevin120202/habit-tracker/internal/notify"
+	"github.com/kevin120202/habit-tracker/internal/oidc"
 	"github.com/kevin120202/habit-tracker/internal/store"
 	"github.com/kevin120202/habit-tracker/migrations"
+	"github.com/kevin120202/habit-tracker/templates"
 )
 
 type Application struct {
-	Logger       *log.Logger
-	HabitHandler *api.HabitHandler
-	TagHandler   *api.TagHandler
-	DB           *sql.DB
+	Logger             *log.Logger
+	HabitHandler       *api.HabitHandler
+	TagHandler         *api.TagHandler
+	SyncHandler        *api.SyncHandler
+	TrashHandler       *api.TrashHandler
+	RoutineHandler     *api.RoutineHandler
+	GoalHandler        *api.GoalHandler
+	UserHandler        *api.UserHandler
+	TokenHandler       *api.TokenHandler
+	AchievementHandler *api.AchievementHandler
+	TemplateHandler    *api.TemplateHandler
+	AuditHandler       *api.AuditHandler
+	JournalHandler     *api.JournalHandler
+	PartnerHandler     *api.PartnerHandler
+	ChallengeHandler   *api.ChallengeHandler
+	GroupHandler       *api.GroupHandler
+	AdminHandler       *api.AdminHandler
+	APIKeyHandler      *api.APIKeyHandler
+	OIDCHandler        *api.OIDCHandler
+	AccountHandler     *api.AccountHandler
+	TwoFactorHandler   *api.TwoFactorHandler
+	SessionHandler     *api.SessionHandler
+	Middleware         middleware.UserMiddleware
+	DB                 *sql.DB
+	trashStore         store.TrashStore
+	syncStore          store.SyncStore
+	accountStore       store.AccountStore
 }
 
-func NewApplication() (*Application, error) {
+// Config holds the settings main reads from flags.
+type Config struct {
+	// OIDC login is only offered when the config is complete.
+	OIDC oidc.Config
+	// AccountDeletionGrace is how long a deleted account can still be
+	// restored before it is purged.
+	AccountDeletionGrace time.Duration
+}
+
+func NewApplication(config Config) (*Application, error) {
 	pgDB, err := store.Open()
 	if err != nil {
 		return nil, err
@@ -30,19 +68,103 @@ func NewApplication() (*Application, error) {
 		panic(err)
 	}
 
+	catalog, err := store.LoadTemplates(templates.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+
 	logger := log.New(os.Stdout, "", log.Ldate|(log.Ltime))
 
+	notifier := notify.NewLogNotifier(logger)
+
 	habitStore := store.NewPostgresHabitStore(pgDB)
 	tagStore := store.NewPostgresTagStore(pgDB)
+	syncStore := store.NewPostgresSyncStore(pgDB)
+	trashStore := store.NewPostgresTrashStore(pgDB)
+	routineStore := store.NewPostgresRoutineStore(pgDB)
+	goalStore := store.NewPostgresGoalStore(pgDB)
+	userStore := store.NewPostgresUserStore(pgDB)
+	tokenStore := store.NewPostgresTokenStore(pgDB)
+	achievementStore := store.NewPostgresAchievementStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB, catalog)
+	auditStore := store.NewPostgresAuditStore(pgDB)
+	journalStore := store.NewPostgresJournalStore(pgDB)
+	partnerStore := store.NewPostgresPartnerStore(pgDB)
+	challengeStore := store.NewPostgresChallengeStore(pgDB)
+	groupStore := store.NewPostgresGroupStore(pgDB)
+	adminStore := store.NewPostgresAdminStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	identityStore := store.NewPostgresIdentityStore(pgDB)
+	accountStore := store.NewPostgresAccountStore(pgDB)
+	twoFactorStore := store.NewPostgresTwoFactorStore(pgDB)
+	sessionStore := store.NewPostgresSessionStore(pgDB)
+
+	habitHandler := api.NewHabitHandler(habitStore, partnerStore, auditStore, logger)
+	tagHandler := api.NewTagHandler(tagStore, auditStore, logger)
+	syncHandler := api.NewSyncHandler(syncStore, logger)
+	trashHandler := api.NewTrashHandler(trashStore, logger)
+	routineHandler := api.NewRoutineHandler(routineStore, habitHandler, logger)
+	goalHandler := api.NewGoalHandler(goalStore, habitStore, logger)
+	userHandler := api.NewUserHandler(userStore, tokenStore, apiKeyStore, notifier, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, twoFactorStore, logger)
+	achievementHandler := api.NewAchievementHandler(achievementStore, habitStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, logger)
+	auditHandler := api.NewAuditHandler(auditStore, logger)
+	journalHandler := api.NewJournalHandler(journalStore, habitStore, logger)
+	partnerHandler := api.NewPartnerHandler(partnerStore, habitStore, userStore, logger)
+	challengeHandler := api.NewChallengeHandler(challengeStore, templateStore, habitStore, logger)
+	groupHandler := api.NewGroupHandler(groupStore, habitStore, userStore, auditStore, logger)
+	adminHandler := api.NewAdminHandler(userStore, tokenStore, apiKeyStore, adminStore, auditStore, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+
+	var oidcProvider *oidc.Provider
+	if config.OIDC.Enabled() {
+		oidcProvider = oidc.NewProvider(config.OIDC, nil)
+	}
+	oidcHandler := api.NewOIDCHandler(oidcProvider, userStore, identityStore, tokenStore, logger)
+	accountHandler := api.NewAccountHandler(accountStore, config.AccountDeletionGrace, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(twoFactorStore, logger)
+	sessionHandler := api.NewSessionHandler(sessionStore, apiKeyStore, logger)
+	middlewareHandler := middleware.UserMiddleware{
+		UserStore:   userStore,
+		APIKeyStore: apiKeyStore,
+		Usage:       middleware.NewUsageRecorder(sessionStore, logger),
+	}
 
-	habitHandler := api.NewHabitHandler(habitStore, logger)
-	tagHandler := api.NewTagHandler(tagStore, logger)
+	habitHandler.OnEntryLogged(goalHandler.EvaluateHabitGoals)
+	habitHandler.OnEntryLogged(achievementHandler.EvaluateAchievements)
+	achievementHandler.OnUnlock(func(user *store.User, rule achievements.Rule, _ *store.Achievement) {
+		logger.Printf("achievement unlocked: %s by %s", rule.Code, user.Username)
+	})
 
 	app := &Application{
-		Logger:       logger,
-		HabitHandler: habitHandler,
-		TagHandler:   tagHandler,
-		DB:           pgDB,
+		Logger:             logger,
+		HabitHandler:       habitHandler,
+		TagHandler:         tagHandler,
+		SyncHandler:        syncHandler,
+		TrashHandler:       trashHandler,
+		RoutineHandler:     routineHandler,
+		GoalHandler:        goalHandler,
+		UserHandler:        userHandler,
+		TokenHandler:       tokenHandler,
+		AchievementHandler: achievementHandler,
+		TemplateHandler:    templateHandler,
+		AuditHandler:       auditHandler,
+		JournalHandler:     journalHandler,
+		PartnerHandler:     partnerHandler,
+		ChallengeHandler:   challengeHandler,
+		GroupHandler:       groupHandler,
+		AdminHandler:       adminHandler,
+		APIKeyHandler:      apiKeyHandler,
+		OIDCHandler:        oidcHandler,
+		AccountHandler:     accountHandler,
+		TwoFactorHandler:   twoFactorHandler,
+		SessionHandler:     sessionHandler,
+		Middleware:         middlewareHandler,
+		DB:                 pgDB,
+		trashStore:         trashStore,
+		syncStore:          syncStore,
+		accountStore:       accountStore,
 	}
 
 	return app, nil
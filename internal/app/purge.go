@@ -0,0 +1,78 @@
+package app
+
+import (
+	"time"
+)
+
+const (
+	trashPurgeInterval     = time.Hour
+	tombstonePurgeInterval = time.Hour
+	accountPurgeInterval   = time.Hour
+	usageFlushInterval     = time.Minute
+)
+
+// StartTrashPurge runs in the background and permanently deletes habits and
+// tags that have been in the trash for longer than retention.
+func (a *Application) StartTrashPurge(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := a.trashStore.PurgeDeletedBefore(time.Now().Add(-retention))
+			if err != nil {
+				a.Logger.Printf("ERROR: purgeTrash: %v", err)
+			} else if purged > 0 {
+				a.Logger.Printf("purged %d items from trash", purged)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// StartTombstonePurge runs in the background and deletes sync tombstones
+// older than retention. Clients that haven't synced since then start over.
+func (a *Application) StartTombstonePurge(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(tombstonePurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := a.syncStore.PurgeTombstones(time.Now().Add(-retention))
+			if err != nil {
+				a.Logger.Printf("ERROR: purgeTombstones: %v", err)
+			} else if purged > 0 {
+				a.Logger.Printf("purged %d sync tombstones", purged)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// StartAccountPurge runs in the background and permanently deletes accounts
+// whose deletion grace period has ended.
+func (a *Application) StartAccountPurge() {
+	go func() {
+		ticker := time.NewTicker(accountPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := a.accountStore.PurgeScheduledDeletions(time.Now())
+			if err != nil {
+				a.Logger.Printf("ERROR: purgeAccounts: %v", err)
+			} else if purged > 0 {
+				a.Logger.Printf("deleted %d accounts", purged)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// StartUsageFlush periodically writes the last-used metadata the auth
+// middleware has collected for tokens and API keys.
+func (a *Application) StartUsageFlush() {
+	a.Middleware.Usage.Start(usageFlushInterval)
+}
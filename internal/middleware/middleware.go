@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+type UserMiddleware struct {
+	UserStore   store.UserStore
+	APIKeyStore store.APIKeyStore
+	// Usage records when credentials were last used; nil disables it.
+	Usage *UsageRecorder
+}
+
+type contextKey string
+
+const (
+	UserContextKey      = contextKey("user")
+	apiKeyContextKey    = contextKey("apiKey")
+	tokenHashContextKey = contextKey("tokenHash")
+)
+
+// APIKeyHeader carries a personal API key instead of a bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyAuth is a verified API key waiting for a route to claim it with
+// RequireScope.
+type apiKeyAuth struct {
+	user *store.User
+	key  *store.APIKey
+}
+
+func SetUser(r *http.Request, user *store.User) *http.Request {
+	ctx := context.WithValue(r.Context(), UserContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// GetUser returns the user attached by Authenticate, or the anonymous user
+// for requests that never passed through it.
+func GetUser(r *http.Request) *store.User {
+	user, ok := r.Context().Value(UserContextKey).(*store.User)
+	if !ok {
+		return store.AnonymousUser
+	}
+	return user
+}
+
+// GetTokenHash returns the hash of the bearer token the request was
+// authenticated with, or nil if it didn't use one.
+func GetTokenHash(r *http.Request) []byte {
+	hash, _ := r.Context().Value(tokenHashContextKey).([]byte)
+	return hash
+}
+
+// Authenticate resolves a bearer token to a user. Requests without an
+// Authorization header continue as the anonymous user.
+//
+// A request carrying an API key instead is verified here but continues as the
+// anonymous user: the key's owner only becomes the request's user on routes
+// wrapped in RequireScope for a scope the key holds.
+func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", APIKeyHeader)
+
+		if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+			um.authenticateAPIKey(w, r, apiKey, next)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			r = SetUser(r, store.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid authorization header"})
+			return
+		}
+
+		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, headerParts[1])
+		if err != nil {
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if user == nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
+			return
+		}
+
+		tokenHash := tokens.Hash(headerParts[1])
+		if um.Usage != nil {
+			um.Usage.record(string(tokenHash), r, store.CredentialUsage{TokenHash: tokenHash})
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), tokenHashContextKey, tokenHash))
+		r = SetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, apiKey string, next http.Handler) {
+	key, err := um.APIKeyStore.GetAPIKey(apiKey)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if key == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired API key"})
+		return
+	}
+
+	user, err := um.UserStore.GetUserByID(key.UserID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil || user.DeactivatedAt != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired API key"})
+		return
+	}
+
+	if um.Usage != nil {
+		um.Usage.record(key.ID.String(), r, store.CredentialUsage{APIKeyID: key.ID})
+	}
+
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, &apiKeyAuth{user: user, key: key})
+	r = SetUser(r.WithContext(ctx), store.AnonymousUser)
+	next.ServeHTTP(w, r)
+}
+
+// RequireScope declares the API key scope a route needs. Requests made with
+// an API key that holds the scope continue as the key's owner, those whose key
+// lacks it are refused, and requests without an API key are unaffected.
+func (um *UserMiddleware) RequireScope(scope string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth, ok := r.Context().Value(apiKeyContextKey).(*apiKeyAuth)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !auth.key.HasScope(scope) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this API key does not have the " + scope + " scope"})
+				return
+			}
+
+			next.ServeHTTP(w, SetUser(r, auth.user))
+		})
+	}
+}
+
+func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if user.IsAnonymous() {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVerifiedUser only lets through signed-in users who have confirmed
+// their email address. It guards features that reach other users.
+func (um *UserMiddleware) RequireVerifiedUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !GetUser(r).IsVerified() {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must verify your email address to use this feature"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole returns chi middleware that only lets through signed-in users
+// whose role on the users table is one of roles.
+func (um *UserMiddleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(roles, GetUser(r).Role) {
+				utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you do not have permission to access this route"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin only lets users with the admin role through.
+func (um *UserMiddleware) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireRole(store.RoleAdmin)(next).ServeHTTP
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/store"
+	"github.com/kevin120202/habit-tracker/internal/utils"
+)
+
+// maxUserAgentLength caps what we keep of a client's User-Agent header.
+const maxUserAgentLength = 256
+
+// UsageRecorder remembers when each token and API key was last used and
+// writes that to the database in batches, so authenticating a request never
+// waits on a write. Only the latest use of each credential per batch is
+// kept.
+type UsageRecorder struct {
+	sessionStore store.SessionStore
+	logger       *log.Logger
+
+	mu      sync.Mutex
+	pending map[string]store.CredentialUsage
+}
+
+func NewUsageRecorder(sessionStore store.SessionStore, logger *log.Logger) *UsageRecorder {
+	return &UsageRecorder{
+		sessionStore: sessionStore,
+		logger:       logger,
+		pending:      map[string]store.CredentialUsage{},
+	}
+}
+
+// record queues a use of the credential identified by key.
+func (ur *UsageRecorder) record(key string, r *http.Request, usage store.CredentialUsage) {
+	usage.UsedAt = time.Now()
+	usage.IP = utils.ClientIP(r)
+	usage.UserAgent = r.UserAgent()
+	if len(usage.UserAgent) > maxUserAgentLength {
+		usage.UserAgent = usage.UserAgent[:maxUserAgentLength]
+	}
+
+	ur.mu.Lock()
+	ur.pending[key] = usage
+	ur.mu.Unlock()
+}
+
+// Flush writes everything recorded since the last flush. On failure the
+// batch is dropped; last-used times are informational and the next request
+// will record them again.
+func (ur *UsageRecorder) Flush() {
+	ur.mu.Lock()
+	pending := ur.pending
+	ur.pending = map[string]store.CredentialUsage{}
+	ur.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	usages := make([]store.CredentialUsage, 0, len(pending))
+	for _, usage := range pending {
+		usages = append(usages, usage)
+	}
+
+	err := ur.sessionStore.RecordUsage(usages)
+	if err != nil {
+		ur.logger.Printf("ERROR: recordUsage: %v", err)
+	}
+}
+
+// Start flushes in the background every interval.
+func (ur *UsageRecorder) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ur.Flush()
+		}
+	}()
+}
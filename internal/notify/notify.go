@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"log"
+	"strings"
+)
+
+// Message is a single notification addressed to one user.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Secret is the one-time token Body carries, if any. Notifiers that
+	// don't deliver the message to the user must not reveal it.
+	Secret string
+}
+
+// Notifier delivers messages to users, for example password reset links.
+type Notifier interface {
+	Send(Message) error
+}
+
+// LogNotifier writes messages to a logger instead of delivering them. It is
+// the default until a mail provider is configured. Secrets are redacted, since
+// anyone who can read the logs could otherwise use them.
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+func NewLogNotifier(logger *log.Logger) *LogNotifier {
+	return &LogNotifier{Logger: logger}
+}
+
+func (n *LogNotifier) Send(msg Message) error {
+	body := msg.Body
+	if msg.Secret != "" {
+		body = strings.ReplaceAll(body, msg.Secret, "[redacted]")
+	}
+
+	n.Logger.Printf("notify: to=%s subject=%q\n%s", msg.To, msg.Subject, body)
+	return nil
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogNotifierRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		want    string
+		wantNot string
+	}{
+		{"secret redacted", Message{To: "a@example.com", Body: "your token: ABC123", Secret: "ABC123"}, "your token: [redacted]", "ABC123"},
+		{"no secret", Message{To: "a@example.com", Body: "welcome back"}, "welcome back", "[redacted]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := NewLogNotifier(log.New(&buf, "", 0)).Send(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(buf.String(), tt.want) || strings.Contains(buf.String(), tt.wantNot) {
+				t.Errorf("logged %q, want %q without %q", buf.String(), tt.want, tt.wantNot)
+			}
+		})
+	}
+}
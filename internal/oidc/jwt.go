@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may drift from ours.
+const clockSkew = time.Minute
+
+// ErrInvalidToken is wrapped by every ID token verification failure.
+var ErrInvalidToken = errors.New("oidc: invalid id token")
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+
+	publicKey *rsa.PublicKey
+}
+
+// rsaPublicKey decodes the key's base64url modulus and exponent.
+func (k *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	if k.publicKey != nil {
+		return k.publicKey, nil
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decoding modulus: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decoding exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("malformed RSA key")
+	}
+
+	k.publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	return k.publicKey, nil
+}
+
+// signingKey returns the RSA key with the given id, refreshing the JWKS once
+// if it isn't cached.
+func (p *Provider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		var jwks struct {
+			Keys []*jsonWebKey `json:"keys"`
+		}
+
+		err = p.getJSON(ctx, doc.JWKSURI, &jwks)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: fetching jwks: %w", err)
+		}
+
+		p.keys = map[string]*jsonWebKey{}
+		for _, k := range jwks.Keys {
+			if k.Kty == "RSA" && (k.Use == "" || k.Use == "sig") {
+				p.keys[k.Kid] = k
+			}
+		}
+
+		key, ok = p.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+		}
+	}
+
+	if key.Alg != "" && key.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: key %q is for %s", ErrInvalidToken, kid, key.Alg)
+	}
+
+	return key.rsaPublicKey()
+}
+
+// audience accepts the aud claim as either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(data, &many)
+	if err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+// flexBool accepts email_verified as a boolean or, as some providers send
+// it, the string "true".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `true`, `"true"`:
+		*b = true
+	case `false`, `"false"`, `null`:
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+
+	return nil
+}
+
+// Verify checks an ID token's RS256 signature against the provider's keys
+// and validates issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	publicKey, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var payload struct {
+		Iss           string   `json:"iss"`
+		Sub           string   `json:"sub"`
+		Aud           audience `json:"aud"`
+		Azp           string   `json:"azp"`
+		Exp           int64    `json:"exp"`
+		Iat           int64    `json:"iat"`
+		Nonce         string   `json:"nonce"`
+		Email         string   `json:"email"`
+		EmailVerified flexBool `json:"email_verified"`
+		Name          string   `json:"name"`
+	}
+
+	err = decodeSegment(parts[1], &payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+
+	now := p.now()
+	switch {
+	case payload.Iss != p.config.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, payload.Iss)
+	case !slices.Contains(payload.Aud, p.config.ClientID):
+		return nil, fmt.Errorf("%w: token is not for this client", ErrInvalidToken)
+	case len(payload.Aud) > 1 && payload.Azp != p.config.ClientID:
+		return nil, fmt.Errorf("%w: token was issued to another party", ErrInvalidToken)
+	case payload.Sub == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	case payload.Exp == 0 || now.After(time.Unix(payload.Exp, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	case payload.Iat != 0 && time.Unix(payload.Iat, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidToken)
+	case nonce != "" && payload.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	return &Claims{
+		Issuer:        payload.Iss,
+		Subject:       payload.Sub,
+		Email:         payload.Email,
+		EmailVerified: bool(payload.EmailVerified),
+		Name:          payload.Name,
+		Nonce:         payload.Nonce,
+		ExpiresAt:     time.Unix(payload.Exp, 0),
+	}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
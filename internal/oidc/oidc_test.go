@@ -0,0 +1,189 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin120202/habit-tracker/internal/oidc/oidctest"
+)
+
+func newTestProvider(stand *oidctest.Provider) *Provider {
+	return NewProvider(Config{
+		Issuer:       stand.Issuer(),
+		ClientID:     stand.ClientID,
+		ClientSecret: stand.ClientSecret,
+		RedirectURL:  "https://habits.example.com/oidc/callback",
+	}, stand.Server.Client())
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+
+	authURL, err := newTestProvider(stand).AuthCodeURL(context.Background(), "the-state", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != stand.Issuer()+"/authorize" {
+		t.Errorf("endpoint = %q, want the discovered authorization endpoint", got)
+	}
+
+	want := map[string]string{
+		"response_type": "code",
+		"client_id":     stand.ClientID,
+		"redirect_uri":  "https://habits.example.com/oidc/callback",
+		"scope":         "openid email profile",
+		"state":         "the-state",
+		"nonce":         "the-nonce",
+	}
+	for param, value := range want {
+		if got := parsed.Query().Get(param); got != value {
+			t.Errorf("%s = %q, want %q", param, got, value)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+
+	provider := NewProvider(Config{
+		Issuer:      stand.Issuer() + "/other",
+		ClientID:    stand.ClientID,
+		RedirectURL: "https://habits.example.com/oidc/callback",
+	}, stand.Server.Client())
+
+	// The stand-in only serves discovery at its own issuer.
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce")
+	if err == nil {
+		t.Fatal("discovery for the wrong issuer succeeded")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+	provider := newTestProvider(stand)
+
+	claims := stand.Claims("user-1")
+	claims["nonce"] = "the-nonce"
+	claims["email"] = "ada@example.com"
+	claims["email_verified"] = "true"
+	claims["name"] = "Ada Lovelace"
+	code := stand.Code(stand.Sign(claims))
+
+	got, err := provider.Exchange(context.Background(), code, "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Issuer != stand.Issuer() || got.Subject != "user-1" || got.Email != "ada@example.com" || !got.EmailVerified || got.Name != "Ada Lovelace" {
+		t.Errorf("claims = %+v", got)
+	}
+
+	_, err = provider.Exchange(context.Background(), code, "the-nonce")
+	if err == nil {
+		t.Error("a used code was exchanged again")
+	}
+
+	_, err = provider.Exchange(context.Background(), "unknown", "the-nonce")
+	if err == nil {
+		t.Error("an unknown code was exchanged")
+	}
+}
+
+func TestExchangeWrongClientSecret(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+	provider := newTestProvider(stand)
+	provider.config.ClientSecret = "wrong"
+
+	_, err := provider.Exchange(context.Background(), stand.Code(stand.Sign(stand.Claims("user-1"))), "")
+	if err == nil {
+		t.Fatal("exchange with the wrong client secret succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	stand := oidctest.NewProvider(t)
+	now := time.Now()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(changes map[string]any) map[string]any {
+		claims := stand.Claims("user-1")
+		claims["nonce"] = "the-nonce"
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	// The payload of one valid token under the signature of another.
+	genuine := strings.Split(stand.Sign(with(nil)), ".")
+	forged := strings.Split(stand.Sign(with(map[string]any{"sub": "admin"})), ".")
+	tampered := genuine[0] + "." + forged[1] + "." + genuine[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		clock   time.Time
+		wantErr bool
+	}{
+		{"valid", stand.Sign(with(nil)), "the-nonce", now, false},
+		{"nonce not checked when none expected", stand.Sign(with(nil)), "", now, false},
+		{"audience list with authorized party", stand.Sign(with(map[string]any{"aud": []string{stand.ClientID, "other"}, "azp": stand.ClientID})), "the-nonce", now, false},
+		{"expiry within clock skew", stand.Sign(with(nil)), "the-nonce", now.Add(time.Hour + 30*time.Second), false},
+		{"signed by another key", oidctest.SignToken(otherKey, map[string]any{"alg": "RS256", "kid": stand.KeyID}, with(nil)), "the-nonce", now, true},
+		{"tampered payload", tampered, "the-nonce", now, true},
+		{"unknown key", oidctest.SignToken(stand.Key, map[string]any{"alg": "RS256", "kid": "rotated"}, with(nil)), "the-nonce", now, true},
+		{"other algorithm", oidctest.SignToken(stand.Key, map[string]any{"alg": "none", "kid": stand.KeyID}, with(nil)), "the-nonce", now, true},
+		{"nonce mismatch", stand.Sign(with(nil)), "another-nonce", now, true},
+		{"missing nonce", stand.Sign(with(map[string]any{"nonce": nil})), "the-nonce", now, true},
+		{"other audience", stand.Sign(with(map[string]any{"aud": "someone-else"})), "the-nonce", now, true},
+		{"audience list without authorized party", stand.Sign(with(map[string]any{"aud": []string{stand.ClientID, "other"}})), "the-nonce", now, true},
+		{"other issuer", stand.Sign(with(map[string]any{"iss": "https://evil.example.com"})), "the-nonce", now, true},
+		{"missing subject", stand.Sign(with(map[string]any{"sub": ""})), "the-nonce", now, true},
+		{"expired", stand.Sign(with(nil)), "the-nonce", now.Add(2 * time.Hour), true},
+		{"issued in the future", stand.Sign(with(nil)), "the-nonce", now.Add(-time.Hour), true},
+		{"malformed", "not.a-token", "the-nonce", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(stand)
+			provider.now = func() time.Time { return tt.clock }
+
+			claims, err := provider.Verify(context.Background(), tt.token, tt.nonce)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("err = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("subject = %q, want user-1", claims.Subject)
+			}
+		})
+	}
+}
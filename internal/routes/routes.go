@@ -3,29 +3,159 @@ package routes
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kevin120202/habit-tracker/internal/app"
+	"github.com/kevin120202/habit-tracker/internal/store"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Use(app.Middleware.Authenticate)
+
+	owner := app.HabitHandler.RequireHabitOwner
+	logger := app.HabitHandler.RequireHabitLogger
+	viewer := app.HabitHandler.RequireHabitViewer
+
+	// Routes reachable with an API key declare the scope they need; every
+	// other route treats API key requests as anonymous.
+	habitsRead := app.Middleware.RequireScope(store.ScopeHabitsRead)
+	habitsWrite := app.Middleware.RequireScope(store.ScopeHabitsWrite)
+	entriesWrite := app.Middleware.RequireScope(store.ScopeEntriesWrite)
+	tagsWrite := app.Middleware.RequireScope(store.ScopeTagsWrite)
+
 	r.Get("/health", app.HealthCheck)
 
-	r.Get("/habits", app.HabitHandler.HandleGetHabits)
-	r.Get("/habits/{id}", app.HabitHandler.HandleGetHabitByID)
-	r.Post("/habits", app.HabitHandler.HandleCreateHabit)
-	r.Put("/habits/{id}", app.HabitHandler.HandleUpdateHabitByID)
-	r.Delete("/habits/{id}", app.HabitHandler.HandleDeleteHabitByID)
-	r.Post("/habits/{id}/log", app.HabitHandler.HandleLogHabitCompletions)
-	r.Post("/habits/{id}/complete", app.HabitHandler.HandleCompleteHabit)
-	r.Get("/habits/tags/{id}", app.HabitHandler.HandleGetHabitsByTag)
-	r.Post("/habits/{id}/tags", app.HabitHandler.HandleCreateTagToHabit)
-	r.Delete("/habits/{id}/tags/{tagID}", app.HabitHandler.HandleDeleteTagFromHabit)
-
-	r.Post("/tags", app.TagHandler.HandleCreateTag)
-	r.Get("/tags", app.TagHandler.HandleGetTags)
-	r.Get("/tags/{id}", app.TagHandler.HandleGetTagByID)
-	r.Put("/tags/{id}", app.TagHandler.HandleUpdateTagByID)
-	r.Delete("/tags/{id}", app.TagHandler.HandleDeleteTagByID)
+	r.Get("/habits", habitsRead(app.HabitHandler.HandleGetHabits))
+	r.Get("/habits/{id}", habitsRead(viewer(app.HabitHandler.HandleGetHabitByID)))
+	r.Post("/habits", habitsWrite(app.HabitHandler.HandleCreateHabit))
+	r.Put("/habits/{id}", habitsWrite(owner(app.HabitHandler.HandleUpdateHabitByID)))
+	r.Delete("/habits/{id}", habitsWrite(owner(app.HabitHandler.HandleDeleteHabitByID)))
+	r.Post("/habits/{id}/restore", habitsWrite(owner(app.HabitHandler.HandleRestoreHabitByID)))
+	r.Post("/habits/{id}/archive", habitsWrite(owner(app.HabitHandler.HandleArchiveHabit)))
+	r.Post("/habits/{id}/unarchive", habitsWrite(owner(app.HabitHandler.HandleUnarchiveHabit)))
+	r.Get("/habits/{id}/pauses", habitsRead(owner(app.HabitHandler.HandleGetHabitPauses)))
+	r.Post("/habits/{id}/pauses", habitsWrite(owner(app.HabitHandler.HandleCreateHabitPause)))
+	r.Delete("/habits/{id}/pauses/{pauseID}", habitsWrite(owner(app.HabitHandler.HandleDeleteHabitPause)))
+	r.Get("/habits/{id}/skips", habitsRead(owner(app.HabitHandler.HandleGetHabitSkips)))
+	r.Post("/habits/{id}/skips", habitsWrite(owner(app.HabitHandler.HandleSkipHabitDay)))
+	r.Delete("/habits/{id}/skips/{skipID}", habitsWrite(owner(app.HabitHandler.HandleDeleteHabitSkip)))
+	r.Get("/habits/{id}/stats", habitsRead(viewer(app.HabitHandler.HandleGetHabitStats)))
+	r.Get("/habits/{id}/history", habitsRead(owner(app.HabitHandler.HandleGetHabitHistory)))
+	r.Post("/habits/{id}/log", entriesWrite(logger(app.HabitHandler.HandleLogHabitCompletions)))
+	r.Post("/habits/{id}/complete", entriesWrite(logger(app.HabitHandler.HandleCompleteHabit)))
+	r.Post("/habits/{id}/timer/start", entriesWrite(logger(app.HabitHandler.HandleStartTimer)))
+	r.Post("/habits/{id}/timer/stop", entriesWrite(logger(app.HabitHandler.HandleStopTimer)))
+	r.Get("/habits/tags/{id}", habitsRead(app.HabitHandler.HandleGetHabitsByTag))
+	r.Post("/habits/{id}/tags", tagsWrite(owner(app.HabitHandler.HandleCreateTagToHabit)))
+	r.Delete("/habits/{id}/tags/{tagID}", tagsWrite(owner(app.HabitHandler.HandleDeleteTagFromHabit)))
+	r.Get("/habits/{id}/links", habitsRead(owner(app.HabitHandler.HandleGetHabitLinks)))
+	r.Post("/habits/{id}/links", habitsWrite(owner(app.HabitHandler.HandleCreateHabitLink)))
+	r.Delete("/habits/{id}/links/{linkID}", habitsWrite(owner(app.HabitHandler.HandleDeleteHabitLink)))
+
+	r.Get("/habits/{id}/goals", habitsRead(owner(app.GoalHandler.HandleGetHabitGoals)))
+	r.Post("/habits/{id}/goals", habitsWrite(owner(app.GoalHandler.HandleCreateGoal)))
+	r.Get("/habits/{id}/goals/{goalID}", habitsRead(owner(app.GoalHandler.HandleGetGoalByID)))
+	r.Put("/habits/{id}/goals/{goalID}", habitsWrite(owner(app.GoalHandler.HandleUpdateGoalByID)))
+	r.Delete("/habits/{id}/goals/{goalID}", habitsWrite(owner(app.GoalHandler.HandleDeleteGoalByID)))
+	r.Get("/goals", habitsRead(app.GoalHandler.HandleGetGoals))
+
+	r.Get("/habits/{id}/partners", owner(app.PartnerHandler.HandleGetHabitPartners))
+	r.Post("/habits/{id}/partners", app.Middleware.RequireVerifiedUser(owner(app.PartnerHandler.HandleInvitePartner)))
+	r.Post("/habits/{id}/nudge", app.Middleware.RequireVerifiedUser(viewer(app.PartnerHandler.HandleNudgeHabit)))
+	r.Get("/partners/habits", app.Middleware.RequireUser(app.PartnerHandler.HandleGetSharedHabits))
+	r.Get("/partners/invitations", app.Middleware.RequireUser(app.PartnerHandler.HandleGetInvitations))
+	r.Post("/partners/invitations/{id}/accept", app.Middleware.RequireUser(app.PartnerHandler.HandleAcceptInvitation))
+	r.Post("/partners/invitations/{id}/decline", app.Middleware.RequireUser(app.PartnerHandler.HandleDeclineInvitation))
+	r.Delete("/partners/{id}", app.Middleware.RequireUser(app.PartnerHandler.HandleRevokePartner))
+	r.Get("/nudges", app.Middleware.RequireUser(app.PartnerHandler.HandleGetNudges))
+
+	r.Post("/groups", app.Middleware.RequireVerifiedUser(app.GroupHandler.HandleCreateGroup))
+	r.Get("/groups", app.Middleware.RequireUser(app.GroupHandler.HandleGetGroups))
+	r.Get("/groups/{id}", app.Middleware.RequireUser(app.GroupHandler.HandleGetGroupByID))
+	r.Delete("/groups/{id}", app.Middleware.RequireUser(app.GroupHandler.HandleDeleteGroup))
+	r.Post("/groups/{id}/members", app.Middleware.RequireVerifiedUser(app.GroupHandler.HandleAddGroupMember))
+	r.Put("/groups/{id}/members/{userID}", app.Middleware.RequireUser(app.GroupHandler.HandleUpdateGroupMember))
+	r.Delete("/groups/{id}/members/{userID}", app.Middleware.RequireUser(app.GroupHandler.HandleRemoveGroupMember))
+	r.Get("/groups/{id}/habits", app.Middleware.RequireUser(app.GroupHandler.HandleGetGroupHabits))
+	r.Post("/groups/{id}/habits", app.Middleware.RequireUser(app.GroupHandler.HandleCreateGroupHabit))
+
+	r.Get("/agenda", habitsRead(app.HabitHandler.HandleGetAgenda))
+
+	r.Post("/tags", tagsWrite(app.TagHandler.HandleCreateTag))
+	r.Get("/tags", habitsRead(app.TagHandler.HandleGetTags))
+	r.Get("/tags/{id}", habitsRead(app.TagHandler.HandleGetTagByID))
+	r.Put("/tags/{id}", tagsWrite(app.TagHandler.HandleUpdateTagByID))
+	r.Delete("/tags/{id}", tagsWrite(app.TagHandler.HandleDeleteTagByID))
+	r.Post("/tags/{id}/restore", tagsWrite(app.TagHandler.HandleRestoreTagByID))
+
+	r.Post("/routines", app.Middleware.RequireUser(app.RoutineHandler.HandleCreateRoutine))
+	r.Get("/routines", app.Middleware.RequireUser(app.RoutineHandler.HandleGetRoutines))
+	r.Get("/routines/{id}", app.Middleware.RequireUser(app.RoutineHandler.HandleGetRoutineByID))
+	r.Put("/routines/{id}", app.Middleware.RequireUser(app.RoutineHandler.HandleUpdateRoutineByID))
+	r.Delete("/routines/{id}", app.Middleware.RequireUser(app.RoutineHandler.HandleDeleteRoutineByID))
+	r.Get("/routines/{id}/progress", app.Middleware.RequireUser(app.RoutineHandler.HandleGetRoutineProgress))
+	r.Post("/routines/{id}/complete", app.Middleware.RequireUser(app.RoutineHandler.HandleCompleteRoutine))
+
+	r.Get("/templates", app.TemplateHandler.HandleGetTemplates)
+	r.Post("/templates", app.Middleware.RequireUser(app.TemplateHandler.HandleCreateTemplate))
+	r.Delete("/templates/{id}", app.Middleware.RequireUser(app.TemplateHandler.HandleDeleteTemplateByID))
+	r.Post("/templates/{id}/instantiate", app.TemplateHandler.HandleInstantiateTemplate)
+
+	r.Get("/journal", app.Middleware.RequireUser(app.JournalHandler.HandleGetJournalEntries))
+	r.Post("/journal", app.Middleware.RequireUser(app.JournalHandler.HandleCreateJournalEntry))
+	r.Get("/journal/stats", app.Middleware.RequireUser(app.JournalHandler.HandleGetJournalStats))
+	r.Get("/journal/{date}", app.Middleware.RequireUser(app.JournalHandler.HandleGetJournalEntryByDate))
+	r.Put("/journal/{date}", app.Middleware.RequireUser(app.JournalHandler.HandleUpdateJournalEntry))
+	r.Delete("/journal/{date}", app.Middleware.RequireUser(app.JournalHandler.HandleDeleteJournalEntry))
+
+	r.Get("/challenges", app.ChallengeHandler.HandleGetChallenges)
+	r.Post("/challenges", app.Middleware.RequireVerifiedUser(app.ChallengeHandler.HandleCreateChallenge))
+	r.Get("/challenges/{id}", app.Middleware.RequireUser(app.ChallengeHandler.HandleGetChallengeByID))
+	r.Delete("/challenges/{id}", app.Middleware.RequireUser(app.ChallengeHandler.HandleDeleteChallenge))
+	r.Post("/challenges/{id}/join", app.Middleware.RequireVerifiedUser(app.ChallengeHandler.HandleJoinChallenge))
+	r.Get("/challenges/{id}/leaderboard", app.Middleware.RequireUser(app.ChallengeHandler.HandleGetLeaderboard))
+
+	r.Get("/trash", app.Middleware.RequireUser(app.TrashHandler.HandleGetTrash))
+
+	r.Get("/sync", app.Middleware.RequireUser(app.SyncHandler.HandleGetChanges))
+	r.Post("/sync", app.Middleware.RequireUser(app.SyncHandler.HandleApplyMutations))
+
+	r.Get("/audit", app.Middleware.RequireAdmin(app.AuditHandler.HandleGetAuditLog))
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(app.Middleware.RequireRole(store.RoleAdmin))
+
+		r.Get("/users", app.AdminHandler.HandleGetUsers)
+		r.Post("/users/{id}/deactivate", app.AdminHandler.HandleDeactivateUser)
+		r.Post("/users/{id}/reactivate", app.AdminHandler.HandleReactivateUser)
+		r.Put("/users/{id}/role", app.AdminHandler.HandleUpdateUserRole)
+		r.Post("/users/{id}/password", app.AdminHandler.HandleResetPassword)
+		r.Get("/stats", app.AdminHandler.HandleGetUsageStats)
+	})
+
+	r.Get("/achievements", app.Middleware.RequireUser(app.AchievementHandler.HandleGetAchievements))
+
+	r.Post("/users", app.UserHandler.HandleRegisterUser)
+	r.Post("/users/verify-email", app.UserHandler.HandleVerifyEmail)
+	r.Delete("/users/me", app.Middleware.RequireUser(app.AccountHandler.HandleDeleteAccount))
+	r.Post("/users/me/restore", app.Middleware.RequireUser(app.AccountHandler.HandleRestoreAccount))
+	r.Get("/users/me/export", app.Middleware.RequireUser(app.AccountHandler.HandleExportAccount))
+	r.Get("/users/me/sessions", app.Middleware.RequireUser(app.SessionHandler.HandleGetSessions))
+	r.Delete("/users/me/sessions", app.Middleware.RequireUser(app.SessionHandler.HandleRevokeAllSessions))
+	r.Delete("/users/me/sessions/{id}", app.Middleware.RequireUser(app.SessionHandler.HandleRevokeSession))
+	r.Get("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleGetTwoFactor))
+	r.Post("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleEnrollTwoFactor))
+	r.Post("/users/me/2fa/confirm", app.Middleware.RequireUser(app.TwoFactorHandler.HandleConfirmTwoFactor))
+	r.Post("/users/me/2fa/recovery-codes", app.Middleware.RequireUser(app.TwoFactorHandler.HandleRegenerateRecoveryCodes))
+	r.Delete("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleDisableTwoFactor))
+	r.Post("/users/me/verification", app.Middleware.RequireUser(app.UserHandler.HandleResendVerification))
+	r.Post("/users/password-reset", app.UserHandler.HandleRequestPasswordReset)
+	r.Put("/users/password", app.UserHandler.HandleResetPassword)
+	r.Get("/users/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleGetAPIKeys))
+	r.Post("/users/me/api-keys", app.Middleware.RequireVerifiedUser(app.APIKeyHandler.HandleCreateAPIKey))
+	r.Delete("/users/me/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+	r.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	r.Get("/oidc/login", app.OIDCHandler.HandleLogin)
+	r.Get("/oidc/callback", app.OIDCHandler.HandleCallback)
 
 	return r
 }
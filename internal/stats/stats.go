@@ -0,0 +1,383 @@
+package stats
+
+import (
+	"time"
+)
+
+// DateRange is an inclusive range of calendar days. A zero End means the
+// range is still open.
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains reports whether the calendar day of t falls inside the range.
+func (dr DateRange) Contains(t time.Time) bool {
+	day := Day(t)
+	if day.Before(Day(dr.Start)) {
+		return false
+	}
+	return dr.End.IsZero() || !day.After(Day(dr.End))
+}
+
+// Entry is a single logged completion with the amount and time it recorded.
+type Entry struct {
+	At       time.Time
+	Value    float64
+	Duration time.Duration
+}
+
+// Target is what a period had to reach under one version of a habit, in
+// effect from the period containing From.
+type Target struct {
+	From     time.Time
+	Count    int
+	Amount   float64
+	Duration time.Duration
+}
+
+// goal returns how much a period needs under this target and how much the
+// given totals contribute towards it.
+func (t Target) goal(count, value float64, duration time.Duration) (target, progress float64) {
+	switch {
+	case t.Duration > 0:
+		return t.Duration.Seconds(), duration.Seconds()
+	case t.Amount > 0:
+		return t.Amount, value
+	default:
+		return float64(max(t.Count, 1)), count
+	}
+}
+
+// Input is everything needed to compute a habit's streaks. A timed habit with
+// TargetDuration meets a period once its sessions add up to that much time; a
+// quantitative habit with TargetAmount once the logged values add up to it.
+// Otherwise a period needs TargetCount entries. For a Quit habit every entry
+// is a relapse and streaks count clean days instead of periods.
+type Input struct {
+	Quit           bool
+	Frequency      string
+	TargetCount    int
+	TargetAmount   float64
+	TargetDuration time.Duration
+	CreatedAt      time.Time
+	Entries        []Entry
+	Pauses         []DateRange
+	Skips          []time.Time
+	// FreezesPerMonth missed periods per calendar month are forgiven
+	// automatically, oldest first.
+	FreezesPerMonth int
+	// History lists the targets the habit has had, oldest first, so each
+	// period is judged by the target in effect at the time. Periods before
+	// the first one use it too. When empty, the current targets apply
+	// throughout. Periods always follow the current Frequency.
+	History []Target
+	Now     time.Time
+}
+
+type Summary struct {
+	CurrentStreak          int     `json:"current_streak"`
+	LongestStreak          int     `json:"longest_streak"`
+	TotalCompletions       int     `json:"total_completions"`
+	PeriodsTracked         int     `json:"periods_tracked"`
+	PeriodsCompleted       int     `json:"periods_completed"`
+	PeriodsSkipped         int     `json:"periods_skipped"`
+	FreezesUsed            int     `json:"freezes_used"`
+	CompletionRate         float64 `json:"completion_rate"`
+	TotalValue             float64 `json:"total_value"`
+	TotalDurationSeconds   int64   `json:"total_duration_seconds"`
+	AverageDurationSeconds int64   `json:"average_duration_seconds"`
+	// CurrentProgress is how far the running period is towards Target, in
+	// seconds for timed habits, as a sum of values for quantitative habits
+	// and as an entry count otherwise.
+	CurrentProgress float64 `json:"current_progress"`
+	Target          float64 `json:"target"`
+	// Relapses and RelapsesPer30Days are only reported for quit habits.
+	Relapses          int     `json:"relapses,omitempty"`
+	RelapsesPer30Days float64 `json:"relapses_per_30_days,omitempty"`
+}
+
+// Day truncates t to midnight UTC of its calendar day. Everything is bucketed
+// in UTC so timestamps read from columns with and without a time zone line up.
+func Day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// PeriodStart returns the start of the daily, weekly (Monday-based) or
+// monthly period containing t. Unknown frequencies are treated as daily.
+func PeriodStart(t time.Time, frequency string) time.Time {
+	day := Day(t)
+	switch frequency {
+	case "weekly":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "monthly":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// NextPeriod returns the start of the period following the one starting at start.
+func NextPeriod(start time.Time, frequency string) time.Time {
+	switch frequency {
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	case "monthly":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+type periodState int
+
+const (
+	periodMissed periodState = iota
+	periodCompleted
+	periodExcused
+	periodSkipped
+	periodFrozen
+)
+
+// Compute walks every period from the habit's creation up to now. A paused or
+// skipped period that was not completed is excused: it neither extends nor
+// breaks a streak. Remaining misses are covered by the monthly freeze
+// allowance before they count against the streak. The current, still-running
+// period only counts once it is completed.
+func Compute(in Input) Summary {
+	if in.Quit {
+		return computeQuit(in)
+	}
+
+	counts := make(map[time.Time]float64)
+	values := make(map[time.Time]float64)
+	durations := make(map[time.Time]time.Duration)
+	first := PeriodStart(in.CreatedAt, in.Frequency)
+	for _, e := range in.Entries {
+		start := PeriodStart(e.At, in.Frequency)
+		counts[start]++
+		values[start] += e.Value
+		durations[start] += e.Duration
+		if start.Before(first) {
+			first = start
+		}
+	}
+	current := PeriodStart(in.Now, in.Frequency)
+
+	// goalFor reports the target of the period starting at start and how far
+	// its entries got towards it.
+	goalFor := func(start time.Time) (float64, float64) {
+		target := Target{Count: in.TargetCount, Amount: in.TargetAmount, Duration: in.TargetDuration}
+		for i, version := range in.History {
+			if i == 0 || !PeriodStart(version.From, in.Frequency).After(start) {
+				target = version
+			}
+		}
+		return target.goal(counts[start], values[start], durations[start])
+	}
+
+	skipped := make(map[time.Time]bool)
+	for _, skip := range in.Skips {
+		skipped[PeriodStart(skip, in.Frequency)] = true
+	}
+
+	freezesUsed := make(map[time.Time]int)
+
+	var states []periodState
+	for start := first; !start.After(current); start = NextPeriod(start, in.Frequency) {
+		end := NextPeriod(start, in.Frequency).AddDate(0, 0, -1)
+		target, progress := goalFor(start)
+		switch {
+		case progress >= target:
+			states = append(states, periodCompleted)
+		case start.Equal(current) || pausedDuring(in.Pauses, start, end):
+			states = append(states, periodExcused)
+		case skipped[start]:
+			states = append(states, periodSkipped)
+		case freezesUsed[monthOf(start)] < in.FreezesPerMonth:
+			freezesUsed[monthOf(start)]++
+			states = append(states, periodFrozen)
+		default:
+			states = append(states, periodMissed)
+		}
+	}
+
+	summary := Summary{TotalCompletions: len(in.Entries)}
+	summary.Target, summary.CurrentProgress = goalFor(current)
+	var timedSessions int64
+	for _, e := range in.Entries {
+		summary.TotalValue += e.Value
+		if e.Duration > 0 {
+			summary.TotalDurationSeconds += int64(e.Duration.Seconds())
+			timedSessions++
+		}
+	}
+	if timedSessions > 0 {
+		summary.AverageDurationSeconds = summary.TotalDurationSeconds / timedSessions
+	}
+
+	run := 0
+	for _, state := range states {
+		switch state {
+		case periodCompleted:
+			run++
+			summary.PeriodsTracked++
+			summary.PeriodsCompleted++
+			summary.LongestStreak = max(summary.LongestStreak, run)
+		case periodMissed:
+			run = 0
+			summary.PeriodsTracked++
+		case periodSkipped:
+			summary.PeriodsSkipped++
+		case periodFrozen:
+			summary.FreezesUsed++
+		}
+	}
+	summary.CurrentStreak = run
+
+	if summary.PeriodsTracked > 0 {
+		summary.CompletionRate = float64(summary.PeriodsCompleted) / float64(summary.PeriodsTracked)
+	}
+
+	return summary
+}
+
+// computeQuit treats entries as relapses. The current streak is the number of
+// clean days since the last relapse (or since the habit was created), and the
+// completion rate is the share of tracked days that were clean.
+func computeQuit(in Input) Summary {
+	start := Day(in.CreatedAt)
+	today := Day(in.Now)
+
+	relapseDays := make(map[time.Time]bool)
+	for _, e := range in.Entries {
+		day := Day(e.At)
+		relapseDays[day] = true
+		if day.Before(start) {
+			start = day
+		}
+	}
+
+	summary := Summary{Relapses: len(in.Entries)}
+
+	run := 0
+	trackedDays := 0
+	cleanDays := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		trackedDays++
+		if relapseDays[day] {
+			run = 0
+			continue
+		}
+		cleanDays++
+		// Today is still in progress, so it doesn't extend the streak yet.
+		if day.Before(today) {
+			run++
+			summary.LongestStreak = max(summary.LongestStreak, run)
+		}
+	}
+	summary.CurrentStreak = run
+
+	summary.PeriodsTracked = trackedDays
+	summary.PeriodsCompleted = cleanDays
+	if trackedDays > 0 {
+		summary.CompletionRate = float64(cleanDays) / float64(trackedDays)
+		summary.RelapsesPer30Days = float64(summary.Relapses) / float64(trackedDays) * 30
+	}
+
+	return summary
+}
+
+// PairSummary describes how often a stacked habit follows its anchor.
+type PairSummary struct {
+	AnchorDays   int     `json:"anchor_days"`
+	TogetherDays int     `json:"together_days"`
+	Rate         float64 `json:"rate"`
+}
+
+// Pair counts the days the anchor habit was done and how many of those days
+// the stacked habit was done as well.
+func Pair(anchor, stacked []time.Time) PairSummary {
+	stackedDays := make(map[time.Time]bool)
+	for _, t := range stacked {
+		stackedDays[Day(t)] = true
+	}
+
+	anchorDays := make(map[time.Time]bool)
+	for _, t := range anchor {
+		anchorDays[Day(t)] = true
+	}
+
+	summary := PairSummary{AnchorDays: len(anchorDays)}
+	for day := range anchorDays {
+		if stackedDays[day] {
+			summary.TogetherDays++
+		}
+	}
+
+	if summary.AnchorDays > 0 {
+		summary.Rate = float64(summary.TogetherDays) / float64(summary.AnchorDays)
+	}
+
+	return summary
+}
+
+// MoodSummary compares the average mood on days a habit was done with the
+// days it wasn't, counting only days that have a mood recorded.
+type MoodSummary struct {
+	DaysDone      int     `json:"days_done"`
+	DaysNotDone   int     `json:"days_not_done"`
+	MoodWhenDone  float64 `json:"mood_when_done"`
+	MoodOtherwise float64 `json:"mood_otherwise"`
+	// Difference is MoodWhenDone minus MoodOtherwise, and zero unless both
+	// kinds of day were seen.
+	Difference float64 `json:"difference"`
+}
+
+// Mood correlates a habit's completions with the moods recorded per day.
+// moods is keyed by Day.
+func Mood(moods map[time.Time]int, completions []time.Time) MoodSummary {
+	doneDays := make(map[time.Time]bool)
+	for _, t := range completions {
+		doneDays[Day(t)] = true
+	}
+
+	var summary MoodSummary
+	var doneTotal, otherTotal int
+	for day, mood := range moods {
+		if doneDays[day] {
+			summary.DaysDone++
+			doneTotal += mood
+		} else {
+			summary.DaysNotDone++
+			otherTotal += mood
+		}
+	}
+
+	if summary.DaysDone > 0 {
+		summary.MoodWhenDone = float64(doneTotal) / float64(summary.DaysDone)
+	}
+	if summary.DaysNotDone > 0 {
+		summary.MoodOtherwise = float64(otherTotal) / float64(summary.DaysNotDone)
+	}
+	if summary.DaysDone > 0 && summary.DaysNotDone > 0 {
+		summary.Difference = summary.MoodWhenDone - summary.MoodOtherwise
+	}
+
+	return summary
+}
+
+func pausedDuring(pauses []DateRange, start, end time.Time) bool {
+	for _, p := range pauses {
+		if !Day(p.Start).After(end) && (p.End.IsZero() || !Day(p.End).Before(start)) {
+			return true
+		}
+	}
+	return false
+}
+
+func monthOf(t time.Time) time.Time {
+	return PeriodStart(t, "monthly")
+}
@@ -0,0 +1,228 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// day returns noon on the nth day after Monday 1 January 2024.
+func day(n int) time.Time {
+	return time.Date(2024, time.January, 1+n, 12, 0, 0, 0, time.UTC)
+}
+
+func entries(days ...int) []Entry {
+	var result []Entry
+	for _, n := range days {
+		result = append(result, Entry{At: day(n), Value: 1})
+	}
+	return result
+}
+
+func TestPeriodStart(t *testing.T) {
+	eastern := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		frequency string
+		want      time.Time
+	}{
+		{"daily", day(3), "daily", time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"daily buckets in UTC", time.Date(2024, 1, 1, 23, 30, 0, 0, eastern), "daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"unknown frequency is daily", day(3), "hourly", time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"weekly from Monday", day(0), "weekly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly Sunday belongs to the week before", day(6), "weekly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", day(30), "monthly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PeriodStart(tt.t, tt.frequency); !got.Equal(tt.want) {
+				t.Errorf("PeriodStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextPeriod(t *testing.T) {
+	start := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		frequency string
+		start     time.Time
+		want      time.Time
+	}{
+		{"daily", start, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly", start, time.Date(2024, 2, 7, 0, 0, 0, 0, time.UTC)},
+		{"monthly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.frequency, func(t *testing.T) {
+			if got := NextPeriod(tt.start, tt.frequency); !got.Equal(tt.want) {
+				t.Errorf("NextPeriod = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDateRangeContains(t *testing.T) {
+	tests := []struct {
+		name string
+		r    DateRange
+		t    time.Time
+		want bool
+	}{
+		{"before start", DateRange{Start: day(2), End: day(4)}, day(1), false},
+		{"start day", DateRange{Start: day(2), End: day(4)}, day(2).Add(-11 * time.Hour), true},
+		{"end day is inclusive", DateRange{Start: day(2), End: day(4)}, day(4).Add(11 * time.Hour), true},
+		{"after end", DateRange{Start: day(2), End: day(4)}, day(5), false},
+		{"open range", DateRange{Start: day(2)}, day(400), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Input
+		want Summary
+	}{
+		{
+			name: "every day done",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 2, 3, 4), Now: day(4)},
+			want: Summary{CurrentStreak: 5, LongestStreak: 5, TotalCompletions: 5, PeriodsTracked: 5, PeriodsCompleted: 5, CompletionRate: 1, TotalValue: 5, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "today not done yet keeps the streak",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 2, 3), Now: day(4)},
+			want: Summary{CurrentStreak: 4, LongestStreak: 4, TotalCompletions: 4, PeriodsTracked: 4, PeriodsCompleted: 4, CompletionRate: 1, TotalValue: 4, Target: 1},
+		},
+		{
+			name: "missed day breaks the streak",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 3, 4), Now: day(4)},
+			want: Summary{CurrentStreak: 2, LongestStreak: 2, TotalCompletions: 4, PeriodsTracked: 5, PeriodsCompleted: 4, CompletionRate: 0.8, TotalValue: 4, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "pause excuses a miss",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 3, 4), Pauses: []DateRange{{Start: day(2), End: day(2)}}, Now: day(4)},
+			want: Summary{CurrentStreak: 4, LongestStreak: 4, TotalCompletions: 4, PeriodsTracked: 4, PeriodsCompleted: 4, CompletionRate: 1, TotalValue: 4, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "skip excuses a miss",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 3, 4), Skips: []time.Time{day(2)}, Now: day(4)},
+			want: Summary{CurrentStreak: 4, LongestStreak: 4, TotalCompletions: 4, PeriodsTracked: 4, PeriodsCompleted: 4, PeriodsSkipped: 1, CompletionRate: 1, TotalValue: 4, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "freeze covers the first miss of the month",
+			in:   Input{Frequency: "daily", CreatedAt: day(0), Entries: entries(0, 1, 3, 5, 6), FreezesPerMonth: 1, Now: day(6)},
+			want: Summary{CurrentStreak: 2, LongestStreak: 3, TotalCompletions: 5, PeriodsTracked: 6, PeriodsCompleted: 5, FreezesUsed: 1, CompletionRate: 5.0 / 6, TotalValue: 5, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "count target",
+			in:   Input{Frequency: "daily", TargetCount: 2, CreatedAt: day(0), Entries: entries(0, 0, 1, 2, 2), Now: day(2)},
+			want: Summary{CurrentStreak: 1, LongestStreak: 1, TotalCompletions: 5, PeriodsTracked: 3, PeriodsCompleted: 2, CompletionRate: 2.0 / 3, TotalValue: 5, CurrentProgress: 2, Target: 2},
+		},
+		{
+			name: "amount target",
+			in: Input{Frequency: "daily", TargetAmount: 10, CreatedAt: day(0), Now: day(1), Entries: []Entry{
+				{At: day(0), Value: 6}, {At: day(0), Value: 5}, {At: day(1), Value: 9},
+			}},
+			want: Summary{CurrentStreak: 1, LongestStreak: 1, TotalCompletions: 3, PeriodsTracked: 1, PeriodsCompleted: 1, CompletionRate: 1, TotalValue: 20, CurrentProgress: 9, Target: 10},
+		},
+		{
+			name: "duration target",
+			in: Input{Frequency: "daily", TargetDuration: 30 * time.Minute, CreatedAt: day(0), Now: day(1), Entries: []Entry{
+				{At: day(0), Value: 1, Duration: 20 * time.Minute},
+				{At: day(0), Value: 1, Duration: 15 * time.Minute},
+				{At: day(1), Value: 1, Duration: 10 * time.Minute},
+			}},
+			want: Summary{CurrentStreak: 1, LongestStreak: 1, TotalCompletions: 3, PeriodsTracked: 1, PeriodsCompleted: 1, CompletionRate: 1, TotalValue: 3, TotalDurationSeconds: 2700, AverageDurationSeconds: 900, CurrentProgress: 600, Target: 1800},
+		},
+		{
+			name: "periods are judged by the target of their time",
+			in: Input{Frequency: "daily", TargetCount: 2, CreatedAt: day(0), Entries: entries(0, 1, 2, 3, 3), Now: day(3), History: []Target{
+				{From: day(0), Count: 1}, {From: day(2), Count: 2},
+			}},
+			want: Summary{CurrentStreak: 1, LongestStreak: 2, TotalCompletions: 5, PeriodsTracked: 4, PeriodsCompleted: 3, CompletionRate: 0.75, TotalValue: 5, CurrentProgress: 2, Target: 2},
+		},
+		{
+			name: "weekly",
+			in:   Input{Frequency: "weekly", CreatedAt: day(0), Entries: entries(2, 9), Now: day(15)},
+			want: Summary{CurrentStreak: 2, LongestStreak: 2, TotalCompletions: 2, PeriodsTracked: 2, PeriodsCompleted: 2, CompletionRate: 1, TotalValue: 2, Target: 1},
+		},
+		{
+			name: "entries before creation are counted",
+			in:   Input{Frequency: "daily", CreatedAt: day(2), Entries: entries(0, 1, 2), Now: day(2)},
+			want: Summary{CurrentStreak: 3, LongestStreak: 3, TotalCompletions: 3, PeriodsTracked: 3, PeriodsCompleted: 3, CompletionRate: 1, TotalValue: 3, CurrentProgress: 1, Target: 1},
+		},
+		{
+			name: "quit habit counts clean days before today",
+			in:   Input{Quit: true, CreatedAt: day(0), Now: day(5)},
+			want: Summary{CurrentStreak: 5, LongestStreak: 5, PeriodsTracked: 6, PeriodsCompleted: 6, CompletionRate: 1},
+		},
+		{
+			name: "relapse resets a quit streak",
+			in:   Input{Quit: true, CreatedAt: day(0), Entries: entries(2), Now: day(5)},
+			want: Summary{CurrentStreak: 2, LongestStreak: 2, PeriodsTracked: 6, PeriodsCompleted: 5, CompletionRate: 5.0 / 6, Relapses: 1, RelapsesPer30Days: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(tt.in); got != tt.want {
+				t.Errorf("Compute =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPair(t *testing.T) {
+	tests := []struct {
+		name    string
+		anchor  []time.Time
+		stacked []time.Time
+		want    PairSummary
+	}{
+		{"no anchor days", nil, []time.Time{day(0)}, PairSummary{}},
+		{"counts days, not entries", []time.Time{day(0), day(0).Add(time.Hour), day(1), day(2)}, []time.Time{day(0), day(2), day(5)}, PairSummary{AnchorDays: 3, TogetherDays: 2, Rate: 2.0 / 3}},
+		{"always together", []time.Time{day(0), day(1)}, []time.Time{day(1), day(0)}, PairSummary{AnchorDays: 2, TogetherDays: 2, Rate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Pair(tt.anchor, tt.stacked); got != tt.want {
+				t.Errorf("Pair = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMood(t *testing.T) {
+	moods := map[time.Time]int{Day(day(0)): 4, Day(day(1)): 2, Day(day(2)): 5}
+
+	tests := []struct {
+		name        string
+		completions []time.Time
+		want        MoodSummary
+	}{
+		{"done and not done", []time.Time{day(0), day(2), day(9)}, MoodSummary{DaysDone: 2, DaysNotDone: 1, MoodWhenDone: 4.5, MoodOtherwise: 2, Difference: 2.5}},
+		{"never done", nil, MoodSummary{DaysNotDone: 3, MoodOtherwise: 11.0 / 3}},
+		{"always done", []time.Time{day(0), day(1), day(2)}, MoodSummary{DaysDone: 3, MoodWhenDone: 11.0 / 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mood(moods, tt.completions); got != tt.want {
+				t.Errorf("Mood = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExportTable is one dataset in a user's data export, with rows in column
+// order.
+type ExportTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]any
+}
+
+// exportQueries select everything stored about the user $1. Tags aren't owned
+// by anyone, so only the tags on the user's habits are included. Journal
+// entries and routines from before they had owners belong to nobody and are
+// left out. Credential hashes are never exported.
+var exportQueries = []struct {
+	name  string
+	query string
+}{
+	{"profile", `
+		SELECT id, username, email, first_name, last_name, role, created_at, updated_at, email_verified_at, deactivated_at, delete_after
+		FROM users
+		WHERE id = $1`},
+	{"habits", `
+		SELECT id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity,
+			freezes_per_month, is_active, archived_at, deleted_at, created_at, updated_at
+		FROM habits
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"habit_entries", `
+		SELECT e.id, e.habit_id, e.completion_date, e.value, e.duration_seconds, e.note, e.created_at
+		FROM habit_entries e
+		INNER JOIN habits h ON h.id = e.habit_id
+		WHERE h.user_id = $1 OR e.completed_by = $1
+		ORDER BY e.completion_date`},
+	{"tags", `
+		SELECT DISTINCT t.id, t.name, t.color, t.created_at, t.updated_at
+		FROM tags t
+		INNER JOIN habit_tags ht ON ht.tag_id = t.id
+		INNER JOIN habits h ON h.id = ht.habit_id
+		WHERE h.user_id = $1
+		ORDER BY t.name`},
+	{"habit_tags", `
+		SELECT ht.habit_id, ht.tag_id
+		FROM habit_tags ht
+		INNER JOIN habits h ON h.id = ht.habit_id
+		WHERE h.user_id = $1`},
+	{"habit_pauses", `
+		SELECT p.id, p.habit_id, p.start_date, p.end_date, p.reason, p.created_at
+		FROM habit_pauses p
+		INNER JOIN habits h ON h.id = p.habit_id
+		WHERE h.user_id = $1
+		ORDER BY p.start_date`},
+	{"habit_skips", `
+		SELECT s.id, s.habit_id, s.skip_date, s.reason, s.created_at
+		FROM habit_skips s
+		INNER JOIN habits h ON h.id = s.habit_id
+		WHERE h.user_id = $1
+		ORDER BY s.skip_date`},
+	{"goals", `
+		SELECT g.id, g.habit_id, g.kind, g.target, g.deadline, g.created_at, g.updated_at
+		FROM goals g
+		INNER JOIN habits h ON h.id = g.habit_id
+		WHERE h.user_id = $1
+		ORDER BY g.created_at`},
+	{"journal_entries", `
+		SELECT id, entry_date, body, mood, energy, created_at, updated_at
+		FROM journal_entries
+		WHERE user_id = $1
+		ORDER BY entry_date`},
+	{"routines", `
+		SELECT id, name, description, created_at, updated_at
+		FROM routines
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"routine_habits", `
+		SELECT rh.routine_id, rh.habit_id, rh.position
+		FROM routine_habits rh
+		INNER JOIN routines r ON r.id = rh.routine_id
+		WHERE r.user_id = $1
+		ORDER BY rh.routine_id, rh.position`},
+	{"achievements", `
+		SELECT id, code, unlocked_at
+		FROM achievements
+		WHERE user_id = $1
+		ORDER BY unlocked_at`},
+	{"habit_templates", `
+		SELECT id, name, description, frequency, target_count, tags, created_at
+		FROM habit_templates
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"partners", `
+		SELECT id, habit_id, owner_id, partner_id, status, created_at, responded_at
+		FROM habit_partners
+		WHERE owner_id = $1 OR partner_id = $1
+		ORDER BY created_at`},
+	{"nudges", `
+		SELECT id, habit_id, from_user_id, to_user_id, created_at
+		FROM habit_nudges
+		WHERE from_user_id = $1 OR to_user_id = $1
+		ORDER BY created_at`},
+	{"group_memberships", `
+		SELECT g.id, g.name, gm.role, gm.joined_at
+		FROM group_members gm
+		INNER JOIN groups g ON g.id = gm.group_id
+		WHERE gm.user_id = $1
+		ORDER BY gm.joined_at`},
+	{"challenges", `
+		SELECT c.id, c.name, c.start_date, c.end_date, c.created_by = $1, cp.habit_id, cp.joined_at
+		FROM challenge_participants cp
+		INNER JOIN challenges c ON c.id = cp.challenge_id
+		WHERE cp.user_id = $1
+		ORDER BY cp.joined_at`},
+	{"sessions", `
+		SELECT id, created_at, expiry, last_used_at, user_agent, ip
+		FROM tokens
+		WHERE user_id = $1 AND scope = 'authentication'
+		ORDER BY created_at`},
+	{"api_keys", `
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, user_agent, ip, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at`},
+	{"identities", `
+		SELECT issuer, subject, created_at
+		FROM user_identities
+		WHERE user_id = $1`},
+	{"audit_log", `
+		SELECT id, action, resource_type, resource_id, ip, created_at
+		FROM audit_log
+		WHERE actor_id = $1
+		ORDER BY created_at`},
+}
+
+type PostgresAccountStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAccountStore(db *sql.DB) *PostgresAccountStore {
+	return &PostgresAccountStore{db: db}
+}
+
+type AccountStore interface {
+	ScheduleDeletion(userID uuid.UUID, deleteAfter time.Time) (time.Time, error)
+	CancelDeletion(userID uuid.UUID) error
+	PurgeScheduledDeletions(now time.Time) (int64, error)
+	Export(userID uuid.UUID) ([]*ExportTable, error)
+}
+
+// ScheduleDeletion marks the account for deletion at deleteAfter. Asking
+// again keeps the original date, which is returned.
+func (pg *PostgresAccountStore) ScheduleDeletion(userID uuid.UUID, deleteAfter time.Time) (time.Time, error) {
+	query := `
+		UPDATE users
+		SET delete_after = COALESCE(delete_after, $1), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING delete_after`
+
+	var scheduled time.Time
+	err := pg.db.QueryRow(query, deleteAfter, userID).Scan(&scheduled)
+	return scheduled, err
+}
+
+func (pg *PostgresAccountStore) CancelDeletion(userID uuid.UUID) error {
+	result, err := pg.db.Exec(`UPDATE users SET delete_after = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND delete_after IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// PurgeScheduledDeletions deletes every account whose grace period ended
+// before now, one transaction per account.
+func (pg *PostgresAccountStore) PurgeScheduledDeletions(now time.Time) (int64, error) {
+	rows, err := pg.db.Query(`SELECT id FROM users WHERE delete_after <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, userID := range userIDs {
+		err = pg.purgeUser(userID)
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purgeUser deletes an account. Deleting the users row cascades to the
+// user's habits and from there to habit_entries, habit_tags and the other
+// per-habit tables, and to their routines. Before that it hands groups and
+// challenges the user created to another member or participant, so only
+// those nobody else belongs to go with them, writes sync tombstones for
+// everything that disappears, deletes their journal and removes tags that no
+// other user's habits use.
+func (pg *PostgresAccountStore) purgeUser(userID uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Admins inherit before members, then the longest-standing member.
+	inheritQuery := `
+		UPDATE group_members gm
+		SET role = 'owner'
+		FROM (
+			SELECT DISTINCT ON (m.group_id) m.group_id, m.user_id
+			FROM group_members m
+			INNER JOIN groups g ON g.id = m.group_id
+			WHERE g.created_by = $1 AND m.user_id <> $1
+			ORDER BY m.group_id, m.role = 'admin' DESC, m.joined_at
+		) heir
+		WHERE gm.group_id = heir.group_id AND gm.user_id = heir.user_id`
+
+	_, err = tx.Exec(inheritQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	transferQuery := `
+		UPDATE groups g
+		SET created_by = gm.user_id
+		FROM group_members gm
+		WHERE gm.group_id = g.id AND gm.role = 'owner' AND g.created_by = $1 AND gm.user_id <> $1`
+
+	_, err = tx.Exec(transferQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	// Challenges go to the participant who joined first.
+	challengeQuery := `
+		UPDATE challenges c
+		SET created_by = heir.user_id
+		FROM (
+			SELECT DISTINCT ON (cp.challenge_id) cp.challenge_id, cp.user_id
+			FROM challenge_participants cp
+			INNER JOIN challenges ch ON ch.id = cp.challenge_id
+			WHERE ch.created_by = $1 AND cp.user_id <> $1
+			ORDER BY cp.challenge_id, cp.joined_at
+		) heir
+		WHERE c.id = heir.challenge_id`
+
+	_, err = tx.Exec(challengeQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	habitIDs, err := queryIDs(tx, `
+		SELECT id FROM habits
+		WHERE deleted_at IS NULL
+		AND (user_id = $1 OR group_id IN (SELECT id FROM groups WHERE created_by = $1))`, userID)
+	if err != nil {
+		return err
+	}
+
+	tagIDs, err := queryIDs(tx, `
+		SELECT t.id FROM tags t
+		WHERE EXISTS (
+			SELECT 1 FROM habit_tags ht
+			INNER JOIN habits h ON h.id = ht.habit_id
+			WHERE ht.tag_id = t.id AND h.user_id = $1
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM habit_tags ht
+			INNER JOIN habits h ON h.id = ht.habit_id
+			WHERE ht.tag_id = t.id AND h.user_id IS DISTINCT FROM $1
+		)`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, habitID := range habitIDs {
+		err = tombstoneHabitEntries(tx, habitID)
+		if err != nil {
+			return err
+		}
+
+		err = recordTombstone(tx, "habit", habitID)
+		if err != nil {
+			return err
+		}
+	}
+
+	journalIDs, err := queryIDs(tx, `SELECT id FROM journal_entries WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, journalID := range journalIDs {
+		err = recordTombstone(tx, "journal", journalID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM journal_entries WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, tagID := range tagIDs {
+		var deletedAt *time.Time
+		err = tx.QueryRow(`DELETE FROM tags WHERE id = $1 RETURNING deleted_at`, tagID).Scan(&deletedAt)
+		if err != nil {
+			return err
+		}
+
+		// Trashed tags were tombstoned when they were trashed.
+		if deletedAt == nil {
+			err = recordTombstone(tx, "tag", tagID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...any) ([]uuid.UUID, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Export reads every dataset in exportQueries for the user inside one
+// read-only transaction, so the tables are consistent with each other.
+func (pg *PostgresAccountStore) Export(userID uuid.UUID) ([]*ExportTable, error) {
+	tx, err := pg.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tables := make([]*ExportTable, 0, len(exportQueries))
+	for _, export := range exportQueries {
+		table, err := exportTable(tx, export.name, export.query, userID)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, tx.Commit()
+}
+
+func exportTable(tx *sql.Tx, name, query string, userID uuid.UUID) (*ExportTable, error) {
+	rows, err := tx.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ExportTable{Name: name, Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+
+		// Text and JSON columns can arrive as bytes.
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+
+		table.Rows = append(table.Rows, values)
+	}
+
+	return table, rows.Err()
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Achievement is a badge a user has unlocked. Code refers to a rule in the
+// achievements package.
+type Achievement struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Code       string
+	UnlockedAt time.Time
+}
+
+type PostgresAchievementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAchievementStore(db *sql.DB) *PostgresAchievementStore {
+	return &PostgresAchievementStore{db: db}
+}
+
+type AchievementStore interface {
+	GetAchievements(userID uuid.UUID) ([]*Achievement, error)
+	AwardAchievement(userID uuid.UUID, code string) (*Achievement, error)
+}
+
+func (pg *PostgresAchievementStore) GetAchievements(userID uuid.UUID) ([]*Achievement, error) {
+	query := `
+		SELECT id, user_id, code, unlocked_at
+		FROM achievements
+		WHERE user_id = $1
+		ORDER BY unlocked_at`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var achievements []*Achievement
+	for rows.Next() {
+		achievement := &Achievement{}
+		err := rows.Scan(&achievement.ID, &achievement.UserID, &achievement.Code, &achievement.UnlockedAt)
+		if err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, achievement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return achievements, nil
+}
+
+// AwardAchievement unlocks a badge for a user. It returns nil if the user
+// already had it, so callers can tell a new unlock from a repeat.
+func (pg *PostgresAchievementStore) AwardAchievement(userID uuid.UUID, code string) (*Achievement, error) {
+	achievement := &Achievement{ID: uuid.New(), UserID: userID, Code: code}
+
+	query := `
+		INSERT INTO achievements (id, user_id, code)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, code) DO NOTHING
+		RETURNING unlocked_at`
+
+	err := pg.db.QueryRow(query, achievement.ID, userID, code).Scan(&achievement.UnlockedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return achievement, nil
+}
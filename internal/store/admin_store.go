@@ -0,0 +1,75 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UsageStats is an instance-wide summary for administrators.
+type UsageStats struct {
+	Users int
+	// ActiveUsers counts users holding an unexpired session token.
+	ActiveUsers      int
+	DeactivatedUsers int
+	Admins           int
+	Habits           int
+	ArchivedHabits   int
+	GroupHabits      int
+	Entries          int
+	EntriesLast7Days int
+	Groups           int
+	Challenges       int
+	JournalEntries   int
+	GeneratedAt      time.Time
+}
+
+type PostgresAdminStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAdminStore(db *sql.DB) *PostgresAdminStore {
+	return &PostgresAdminStore{db: db}
+}
+
+type AdminStore interface {
+	GetUsageStats() (*UsageStats, error)
+}
+
+func (pg *PostgresAdminStore) GetUsageStats() (*UsageStats, error) {
+	usage := &UsageStats{GeneratedAt: time.Now()}
+
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(DISTINCT user_id) FROM tokens WHERE expiry > $1 AND scope = 'authentication'),
+			(SELECT COUNT(*) FROM users WHERE deactivated_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE role = 'admin'),
+			(SELECT COUNT(*) FROM habits WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM habits WHERE deleted_at IS NULL AND archived_at IS NOT NULL),
+			(SELECT COUNT(*) FROM habits WHERE deleted_at IS NULL AND group_id IS NOT NULL),
+			(SELECT COUNT(*) FROM habit_entries),
+			(SELECT COUNT(*) FROM habit_entries WHERE completion_date >= $2),
+			(SELECT COUNT(*) FROM groups),
+			(SELECT COUNT(*) FROM challenges),
+			(SELECT COUNT(*) FROM journal_entries)`
+
+	err := pg.db.QueryRow(query, usage.GeneratedAt, usage.GeneratedAt.AddDate(0, 0, -7)).Scan(
+		&usage.Users,
+		&usage.ActiveUsers,
+		&usage.DeactivatedUsers,
+		&usage.Admins,
+		&usage.Habits,
+		&usage.ArchivedHabits,
+		&usage.GroupHabits,
+		&usage.Entries,
+		&usage.EntriesLast7Days,
+		&usage.Groups,
+		&usage.Challenges,
+		&usage.JournalEntries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+// Scopes an API key can be granted. Routes reachable with an API key each
+// declare the one they need.
+const (
+	ScopeHabitsRead   = "habits:read"
+	ScopeHabitsWrite  = "habits:write"
+	ScopeEntriesWrite = "entries:write"
+	ScopeTagsWrite    = "tags:write"
+)
+
+// APIScopes lists every valid API key scope.
+var APIScopes = []string{ScopeHabitsRead, ScopeHabitsWrite, ScopeEntriesWrite, ScopeTagsWrite}
+
+// APIKey is a long-lived credential for scripts. Prefix is the start of the
+// plaintext, kept so users can tell their keys apart.
+type APIKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	// UserAgent and IP describe the client that last used the key.
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(*APIKey) (string, error)
+	GetAPIKeys(userID uuid.UUID) ([]*APIKey, error)
+	GetAPIKey(plaintext string) (*APIKey, error)
+	DeleteAPIKey(id, userID uuid.UUID) error
+	DeleteAllAPIKeysForUser(userID uuid.UUID) error
+}
+
+// CreateAPIKey generates and stores a new key, returning its plaintext. The
+// plaintext can't be recovered later.
+func (pg *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) (string, error) {
+	plaintext, err := tokens.GenerateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	key.ID = uuid.New()
+	key.Prefix = plaintext[:len(tokens.APIKeyPrefix)+6]
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at`
+
+	err = pg.db.QueryRow(query, key.ID, key.UserID, key.Name, key.Prefix, tokens.Hash(plaintext), scopes, key.ExpiresAt).Scan(&key.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeys(userID uuid.UUID) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, user_agent, ip, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes []byte
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.UserAgent, &key.IP, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(scopes, &key.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKey looks up an unexpired key by its plaintext. It returns nil when
+// there is no such key.
+func (pg *PostgresAPIKeyStore) GetAPIKey(plaintext string) (*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, user_agent, ip, created_at
+		FROM api_keys
+		WHERE hash = $1 AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+
+	key, err := scanAPIKey(pg.db.QueryRow(query, tokens.Hash(plaintext)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(id, userID uuid.UUID) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteAllAPIKeysForUser revokes every key the user has, for example after
+// their password is reset.
+func (pg *PostgresAPIKeyStore) DeleteAllAPIKeysForUser(userID uuid.UUID) error {
+	_, err := pg.db.Exec(`DELETE FROM api_keys WHERE user_id = $1`, userID)
+	return err
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records one mutation made through the API. Before and After
+// hold the resource as JSON and are nil where there was nothing to capture,
+// such as Before on a create.
+type AuditEntry struct {
+	ID           uuid.UUID
+	ActorID      *uuid.UUID
+	Action       string
+	ResourceType string
+	ResourceID   uuid.UUID
+	Before       json.RawMessage
+	After        json.RawMessage
+	IP           string
+	CreatedAt    time.Time
+}
+
+// AuditFilter narrows GetAuditEntries. Zero fields don't filter.
+type AuditFilter struct {
+	ActorID      *uuid.UUID
+	Action       string
+	ResourceType string
+	ResourceID   *uuid.UUID
+	Since        *time.Time
+	Until        *time.Time
+	Limit        int
+}
+
+type PostgresAuditStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditStore(db *sql.DB) *PostgresAuditStore {
+	return &PostgresAuditStore{db: db}
+}
+
+type AuditStore interface {
+	RecordAudit(entry *AuditEntry) error
+	GetAuditEntries(filter AuditFilter) ([]*AuditEntry, error)
+}
+
+func (pg *PostgresAuditStore) RecordAudit(entry *AuditEntry) error {
+	entry.ID = uuid.New()
+
+	query := `
+		INSERT INTO audit_log (id, actor_id, action, resource_type, resource_id, before, after, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`
+
+	return pg.db.QueryRow(query, entry.ID, entry.ActorID, entry.Action, entry.ResourceType, entry.ResourceID, nullJSON(entry.Before), nullJSON(entry.After), entry.IP).Scan(&entry.CreatedAt)
+}
+
+// nullJSON stores a missing snapshot as SQL NULL rather than JSON null.
+func nullJSON(data json.RawMessage) any {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return []byte(data)
+}
+
+// GetAuditEntries returns matching entries, newest first.
+func (pg *PostgresAuditStore) GetAuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	var conditions []string
+	var args []any
+
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != nil {
+		where("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		where("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != nil {
+		where("resource_id = $%d", *filter.ResourceID)
+	}
+	if filter.Since != nil {
+		where("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		where("created_at < $%d", *filter.Until)
+	}
+
+	query := `
+		SELECT id, actor_id, action, resource_type, resource_id, before, after, ip, created_at
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += `
+		WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(`
+		ORDER BY created_at DESC
+		LIMIT $%d`, len(args))
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		entry := &AuditEntry{}
+		var before, after []byte
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.ResourceType, &entry.ResourceID, &before, &after, &entry.IP, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Challenge is a shared habit run between StartDate and EndDate, both
+// inclusive. Everyone who joins gets their own habit made from TemplateID.
+type Challenge struct {
+	ID          uuid.UUID
+	Name        string
+	Description string
+	TemplateID  string
+	StartDate   time.Time
+	EndDate     time.Time
+	CreatedBy   uuid.UUID
+	CreatedAt   time.Time
+}
+
+// ChallengeParticipant links a user to the habit they track the challenge
+// with.
+type ChallengeParticipant struct {
+	ID          uuid.UUID
+	ChallengeID uuid.UUID
+	UserID      uuid.UUID
+	Username    string
+	HabitID     uuid.UUID
+	JoinedAt    time.Time
+}
+
+type PostgresChallengeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChallengeStore(db *sql.DB) *PostgresChallengeStore {
+	return &PostgresChallengeStore{db: db}
+}
+
+type ChallengeStore interface {
+	CreateChallenge(*Challenge) (*Challenge, error)
+	GetChallenges() ([]*Challenge, error)
+	GetChallengeByID(id uuid.UUID) (*Challenge, error)
+	DeleteChallenge(id, userID uuid.UUID) error
+	JoinChallenge(challengeID, userID uuid.UUID, template *HabitTemplate) (*ChallengeParticipant, *Habit, error)
+	GetParticipants(challengeID uuid.UUID) ([]*ChallengeParticipant, error)
+}
+
+func (pg *PostgresChallengeStore) CreateChallenge(challenge *Challenge) (*Challenge, error) {
+	challenge.ID = uuid.New()
+
+	query := `
+		INSERT INTO challenges (id, name, description, template_id, start_date, end_date, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at`
+
+	err := pg.db.QueryRow(query, challenge.ID, challenge.Name, challenge.Description, challenge.TemplateID, challenge.StartDate, challenge.EndDate, challenge.CreatedBy).Scan(&challenge.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// GetChallenges returns every challenge, the most recent start first.
+func (pg *PostgresChallengeStore) GetChallenges() ([]*Challenge, error) {
+	query := `
+		SELECT id, name, description, template_id, start_date, end_date, created_by, created_at
+		FROM challenges
+		ORDER BY start_date DESC, name`
+
+	rows, err := pg.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []*Challenge{}
+	for rows.Next() {
+		challenge := &Challenge{}
+		err := rows.Scan(&challenge.ID, &challenge.Name, &challenge.Description, &challenge.TemplateID, &challenge.StartDate, &challenge.EndDate, &challenge.CreatedBy, &challenge.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, challenge)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return challenges, nil
+}
+
+func (pg *PostgresChallengeStore) GetChallengeByID(id uuid.UUID) (*Challenge, error) {
+	challenge := &Challenge{}
+
+	query := `
+		SELECT id, name, description, template_id, start_date, end_date, created_by, created_at
+		FROM challenges
+		WHERE id = $1`
+
+	err := pg.db.QueryRow(query, id).Scan(&challenge.ID, &challenge.Name, &challenge.Description, &challenge.TemplateID, &challenge.StartDate, &challenge.EndDate, &challenge.CreatedBy, &challenge.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// DeleteChallenge removes a challenge created by userID. The participants'
+// habits are kept.
+func (pg *PostgresChallengeStore) DeleteChallenge(id, userID uuid.UUID) error {
+	query := `
+		DELETE FROM challenges
+		WHERE id = $1 AND created_by = $2`
+
+	result, err := pg.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// JoinChallenge signs userID up and creates their habit from the template in
+// the same transaction.
+func (pg *PostgresChallengeStore) JoinChallenge(challengeID, userID uuid.UUID, template *HabitTemplate) (*ChallengeParticipant, *Habit, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	habit, _, err := instantiateTemplate(tx, template, &userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	participant := &ChallengeParticipant{
+		ID:          uuid.New(),
+		ChallengeID: challengeID,
+		UserID:      userID,
+		HabitID:     habit.ID,
+	}
+
+	query := `
+		INSERT INTO challenge_participants (id, challenge_id, user_id, habit_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING joined_at, (SELECT username FROM users WHERE id = $3)`
+
+	err = tx.QueryRow(query, participant.ID, participant.ChallengeID, participant.UserID, participant.HabitID).Scan(&participant.JoinedAt, &participant.Username)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, nil, errors.New("already joined this challenge")
+		}
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return participant, habit, nil
+}
+
+func (pg *PostgresChallengeStore) GetParticipants(challengeID uuid.UUID) ([]*ChallengeParticipant, error) {
+	query := `
+		SELECT cp.id, cp.challenge_id, cp.user_id, u.username, cp.habit_id, cp.joined_at
+		FROM challenge_participants cp
+		INNER JOIN users u ON u.id = cp.user_id
+		WHERE cp.challenge_id = $1
+		ORDER BY cp.joined_at`
+
+	rows, err := pg.db.Query(query, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []*ChallengeParticipant{}
+	for rows.Next() {
+		participant := &ChallengeParticipant{}
+		err := rows.Scan(&participant.ID, &participant.ChallengeID, &participant.UserID, &participant.Username, &participant.HabitID, &participant.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, participant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
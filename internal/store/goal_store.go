@@ -0,0 +1,202 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// GoalKindTotal counts entries logged after the goal was set.
+	GoalKindTotal = "total"
+	// GoalKindValue sums entry values logged after the goal was set.
+	GoalKindValue = "value"
+	// GoalKindStreak is reached once the habit's streak hits the target.
+	GoalKindStreak = "streak"
+)
+
+// Goal is a long-term objective on a habit, such as "100 runs by December".
+// Milestone is set once the goal has been reached.
+type Goal struct {
+	ID        uuid.UUID
+	HabitID   uuid.UUID
+	Kind      string
+	Target    float64
+	Deadline  *time.Time
+	Milestone *Milestone
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Milestone struct {
+	ID         uuid.UUID
+	GoalID     uuid.UUID
+	AchievedAt time.Time
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{db: db}
+}
+
+type GoalStore interface {
+	CreateGoal(*Goal) (*Goal, error)
+	GetGoalByID(habitID, goalID uuid.UUID) (*Goal, error)
+	GetGoalsForHabit(habitID uuid.UUID) ([]*Goal, error)
+	GetGoalsForUser(userID uuid.UUID) ([]*Goal, error)
+	UpdateGoal(*Goal) error
+	DeleteGoal(habitID, goalID uuid.UUID) error
+	RecordMilestone(goalID uuid.UUID, achievedAt time.Time) (*Milestone, error)
+}
+
+func (pg *PostgresGoalStore) CreateGoal(goal *Goal) (*Goal, error) {
+	goal.ID = uuid.New()
+
+	query := `
+		INSERT INTO goals (id, habit_id, kind, target, deadline)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at`
+
+	err := pg.db.QueryRow(query, goal.ID, goal.HabitID, goal.Kind, goal.Target, goal.Deadline).Scan(&goal.CreatedAt, &goal.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return goal, nil
+}
+
+const goalColumns = `
+		SELECT g.id, g.habit_id, g.kind, g.target, g.deadline, g.created_at, g.updated_at, m.id, m.achieved_at
+		FROM goals g
+		INNER JOIN habits h ON h.id = g.habit_id
+		LEFT JOIN milestones m ON m.goal_id = g.id`
+
+func (pg *PostgresGoalStore) GetGoalByID(habitID, goalID uuid.UUID) (*Goal, error) {
+	query := goalColumns + `
+		WHERE g.id = $1 AND g.habit_id = $2 AND h.deleted_at IS NULL`
+
+	goals, err := pg.queryGoals(query, goalID, habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(goals) == 0 {
+		return nil, nil
+	}
+
+	return goals[0], nil
+}
+
+func (pg *PostgresGoalStore) GetGoalsForHabit(habitID uuid.UUID) ([]*Goal, error) {
+	query := goalColumns + `
+		WHERE g.habit_id = $1 AND h.deleted_at IS NULL
+		ORDER BY g.created_at`
+
+	return pg.queryGoals(query, habitID)
+}
+
+// GetGoalsForUser returns the goals on every habit userID may list.
+func (pg *PostgresGoalStore) GetGoalsForUser(userID uuid.UUID) ([]*Goal, error) {
+	query := goalColumns + `
+		WHERE h.deleted_at IS NULL` + visibleTo + `
+		ORDER BY g.deadline NULLS LAST, g.created_at`
+
+	return pg.queryGoals(query, userID)
+}
+
+func (pg *PostgresGoalStore) queryGoals(query string, args ...any) ([]*Goal, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []*Goal
+	for rows.Next() {
+		goal := &Goal{}
+		var milestoneID uuid.NullUUID
+		var achievedAt sql.NullTime
+		err := rows.Scan(&goal.ID, &goal.HabitID, &goal.Kind, &goal.Target, &goal.Deadline, &goal.CreatedAt, &goal.UpdatedAt, &milestoneID, &achievedAt)
+		if err != nil {
+			return nil, err
+		}
+		if milestoneID.Valid {
+			goal.Milestone = &Milestone{ID: milestoneID.UUID, GoalID: goal.ID, AchievedAt: achievedAt.Time}
+		}
+		goals = append(goals, goal)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+func (pg *PostgresGoalStore) UpdateGoal(goal *Goal) error {
+	query := `UPDATE goals
+		SET kind = $1, target = $2, deadline = $3, updated_at = $4
+		WHERE id = $5 AND habit_id = $6
+	`
+
+	result, err := pg.db.Exec(query, goal.Kind, goal.Target, goal.Deadline, time.Now(), goal.ID, goal.HabitID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresGoalStore) DeleteGoal(habitID, goalID uuid.UUID) error {
+	query := `
+		DELETE from goals
+		WHERE id = $1 AND habit_id = $2`
+
+	result, err := pg.db.Exec(query, goalID, habitID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RecordMilestone marks a goal as reached. A goal is only ever reached once,
+// so recording it again returns the existing milestone.
+func (pg *PostgresGoalStore) RecordMilestone(goalID uuid.UUID, achievedAt time.Time) (*Milestone, error) {
+	milestone := &Milestone{GoalID: goalID}
+
+	query := `
+		INSERT INTO milestones (id, goal_id, achieved_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (goal_id) DO UPDATE SET goal_id = EXCLUDED.goal_id
+		RETURNING id, achieved_at`
+
+	err := pg.db.QueryRow(query, uuid.New(), goalID, achievedAt).Scan(&milestone.ID, &milestone.AchievedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return milestone, nil
+}
@@ -0,0 +1,344 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// GroupRoleOwner created the group; there is exactly one.
+	GroupRoleOwner = "owner"
+	// GroupRoleAdmin manages members and the group's habits.
+	GroupRoleAdmin = "admin"
+	// GroupRoleMember can log the group's habits.
+	GroupRoleMember = "member"
+)
+
+// Group owns shared habits that any of its members can log.
+type Group struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedBy uuid.UUID
+	CreatedAt time.Time
+}
+
+type GroupMember struct {
+	GroupID  uuid.UUID
+	UserID   uuid.UUID
+	Username string
+	Role     string
+	JoinedAt time.Time
+}
+
+type PostgresGroupStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGroupStore(db *sql.DB) *PostgresGroupStore {
+	return &PostgresGroupStore{db: db}
+}
+
+type GroupStore interface {
+	CreateGroup(*Group) (*Group, error)
+	GetGroupsForUser(userID uuid.UUID) ([]*Group, error)
+	GetGroupByID(id uuid.UUID) (*Group, error)
+	DeleteGroup(id uuid.UUID) error
+	GetMembers(groupID uuid.UUID) ([]*GroupMember, error)
+	GetMemberRole(groupID, userID uuid.UUID) (string, error)
+	AddMember(groupID, userID uuid.UUID, role string) (*GroupMember, error)
+	UpdateMemberRole(groupID, userID uuid.UUID, role string) error
+	RemoveMember(groupID, userID uuid.UUID) error
+}
+
+// CreateGroup creates the group with its creator as the owner.
+func (pg *PostgresGroupStore) CreateGroup(group *Group) (*Group, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	group.ID = uuid.New()
+
+	query := `
+		INSERT INTO groups (id, name, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING created_at`
+
+	err = tx.QueryRow(query, group.ID, group.Name, group.CreatedBy).Scan(&group.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, $3)`, group.ID, group.CreatedBy, GroupRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (pg *PostgresGroupStore) GetGroupsForUser(userID uuid.UUID) ([]*Group, error) {
+	query := `
+		SELECT g.id, g.name, g.created_by, g.created_at
+		FROM groups g
+		INNER JOIN group_members gm ON gm.group_id = g.id
+		WHERE gm.user_id = $1
+		ORDER BY g.name`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*Group{}
+	for rows.Next() {
+		group := &Group{}
+		err := rows.Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (pg *PostgresGroupStore) GetGroupByID(id uuid.UUID) (*Group, error) {
+	group := &Group{}
+
+	query := `
+		SELECT id, name, created_by, created_at
+		FROM groups
+		WHERE id = $1`
+
+	err := pg.db.QueryRow(query, id).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// DeleteGroup removes the group together with its memberships and habits,
+// leaving sync tombstones so the members' clients drop the habits too.
+func (pg *PostgresGroupStore) DeleteGroup(id uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	habitIDs, err := queryIDs(tx, `SELECT id FROM habits WHERE group_id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, habitID := range habitIDs {
+		err = tombstoneHabitEntries(tx, habitID)
+		if err != nil {
+			return err
+		}
+
+		err = recordTombstone(tx, "habit", habitID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = readdressGroupTombstones(tx, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM groups WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// readdressGroupTombstones gives every member their own copy of the group's
+// tombstones. Group tombstones only sync to current members, and nobody is a
+// member once the group is deleted.
+func readdressGroupTombstones(tx *sql.Tx, groupID uuid.UUID) error {
+	memberIDs, err := queryIDs(tx, `SELECT user_id FROM group_members WHERE group_id = $1`, groupID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT resource_type, resource_id, deleted_at FROM tombstones WHERE group_id = $1`, groupID)
+	if err != nil {
+		return err
+	}
+
+	var tombstones []*Tombstone
+	for rows.Next() {
+		tombstone := &Tombstone{}
+		if err := rows.Scan(&tombstone.ResourceType, &tombstone.ResourceID, &tombstone.DeletedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO tombstones (id, resource_type, resource_id, deleted_at, user_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, memberID := range memberIDs {
+		for _, tombstone := range tombstones {
+			_, err = tx.Exec(query, uuid.New(), tombstone.ResourceType, tombstone.ResourceID, tombstone.DeletedAt, memberID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM tombstones WHERE group_id = $1`, groupID)
+	return err
+}
+
+func (pg *PostgresGroupStore) GetMembers(groupID uuid.UUID) ([]*GroupMember, error) {
+	query := `
+		SELECT gm.group_id, gm.user_id, u.username, gm.role, gm.joined_at
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = $1
+		ORDER BY gm.joined_at`
+
+	rows, err := pg.db.Query(query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*GroupMember{}
+	for rows.Next() {
+		member := &GroupMember{}
+		err := rows.Scan(&member.GroupID, &member.UserID, &member.Username, &member.Role, &member.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetMemberRole returns the user's role in the group, or "" when they are not
+// a member.
+func (pg *PostgresGroupStore) GetMemberRole(groupID, userID uuid.UUID) (string, error) {
+	var role string
+
+	err := pg.db.QueryRow(`SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return role, err
+}
+
+func (pg *PostgresGroupStore) AddMember(groupID, userID uuid.UUID, role string) (*GroupMember, error) {
+	member := &GroupMember{GroupID: groupID, UserID: userID, Role: role}
+
+	query := `
+		INSERT INTO group_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
+		RETURNING joined_at, (SELECT username FROM users WHERE id = $2)`
+
+	err := pg.db.QueryRow(query, groupID, userID, role).Scan(&member.JoinedAt, &member.Username)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, errors.New("user is already a member of this group")
+		}
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// UpdateMemberRole changes a member's role. The owner's role can't be
+// changed.
+func (pg *PostgresGroupStore) UpdateMemberRole(groupID, userID uuid.UUID, role string) error {
+	query := `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND user_id = $3 AND role <> 'owner'`
+
+	result, err := pg.db.Exec(query, role, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RemoveMember removes a member. The owner can't be removed; deleting the
+// group is the only way out for them.
+func (pg *PostgresGroupStore) RemoveMember(groupID, userID uuid.UUID) error {
+	query := `
+		DELETE FROM group_members
+		WHERE group_id = $1 AND user_id = $2 AND role <> 'owner'`
+
+	result, err := pg.db.Exec(query, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,21 +11,93 @@ import (
 
 type Habit struct {
 	ID uuid.UUID
-	// UserID      uuid.UUID
-	Name        string
-	Description string
-	Frequency   string
-	TargetCount int
-	IsActive    bool
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// UserID owns the habit. Habits without an owner predate accounts and
+	// stay visible to everyone.
+	UserID *uuid.UUID
+	// GroupID owns a shared habit instead of UserID; any member may log it.
+	GroupID               *uuid.UUID
+	Name                  string
+	Description           string
+	Frequency             string
+	TargetCount           int
+	Unit                  string
+	TargetAmount          *float64
+	TargetDurationSeconds *int
+	Polarity              string
+	IsActive              bool
+	FreezesPerMonth       int
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	ArchivedAt            *time.Time
+	DeletedAt             *time.Time
 }
 
+const (
+	// PolarityBuild habits are things to do; every entry is a completion.
+	PolarityBuild = "build"
+	// PolarityQuit habits are things to avoid; every entry is a relapse.
+	PolarityQuit = "quit"
+)
+
 type HabitEntry struct {
-	ID         uuid.UUID
-	HabitID    uuid.UUID
-	Completion time.Time
-	Note       string
+	ID              uuid.UUID
+	HabitID         uuid.UUID
+	Completion      time.Time
+	Value           float64
+	DurationSeconds int
+	Note            string
+	// CompletedBy is the user who logged the entry, if any.
+	CompletedBy *uuid.UUID
+	UpdatedAt   time.Time
+}
+
+// HabitTimer is an in-progress timed session; stopping it logs a HabitEntry.
+// Each user has their own timer on a habit; UserID is nil for anonymous ones.
+type HabitTimer struct {
+	HabitID   uuid.UUID
+	UserID    *uuid.UUID
+	StartedAt time.Time
+}
+
+// HabitPause is a date range during which missed periods don't break a streak.
+// A nil EndDate leaves the pause open until it is removed.
+type HabitPause struct {
+	ID        uuid.UUID
+	HabitID   uuid.UUID
+	StartDate time.Time
+	EndDate   *time.Time
+	Reason    string
+}
+
+// HabitSkip marks a scheduled day as deliberately skipped (sick, travelling).
+// A skipped day is neither a completion nor a miss.
+type HabitSkip struct {
+	ID       uuid.UUID
+	HabitID  uuid.UUID
+	SkipDate time.Time
+	Reason   string
+}
+
+// HabitLink stacks a habit after another one: HabitID is meant to follow
+// AfterHabitID, so it only comes up once AfterHabitID is done.
+type HabitLink struct {
+	ID           uuid.UUID
+	HabitID      uuid.UUID
+	AfterHabitID uuid.UUID
+	CreatedAt    time.Time
+}
+
+// HabitVersion is the name, frequency and targets a habit had from
+// EffectiveFrom until the next version.
+type HabitVersion struct {
+	ID                    uuid.UUID
+	HabitID               uuid.UUID
+	Name                  string
+	Frequency             string
+	TargetCount           int
+	TargetAmount          *float64
+	TargetDurationSeconds *int
+	EffectiveFrom         time.Time
 }
 
 type HabitTags struct {
@@ -43,30 +117,45 @@ func NewPostgresHabitStore(db *sql.DB) *PostgresHabitStore {
 type HabitStore interface {
 	CreateHabit(*Habit) (*Habit, error)
 	GetHabitByID(id uuid.UUID) (*Habit, error)
-	GetHabits() ([]*Habit, error)
+	GetHabitIncludingTrashed(id uuid.UUID) (*Habit, error)
+	GetHabitsForUser(userID uuid.UUID) ([]*Habit, error)
+	GetArchivedHabitsForUser(userID uuid.UUID) ([]*Habit, error)
+	GetGroupHabits(groupID uuid.UUID) ([]*Habit, error)
+	GetHabitGroupRole(habitID, userID uuid.UUID) (string, error)
 	UpdateHabit(*Habit) error
 	DeleteHabit(id uuid.UUID) error
+	RestoreHabit(id uuid.UUID) error
+	ArchiveHabit(id uuid.UUID) error
+	UnarchiveHabit(id uuid.UUID) error
 	LogHabit(*HabitEntry) (*HabitEntry, error)
+	StartTimer(habitID uuid.UUID, userID *uuid.UUID) (*HabitTimer, error)
+	StopTimer(habitID uuid.UUID, note string, userID *uuid.UUID) (*HabitEntry, error)
+	GetHabitEntries(habitID uuid.UUID) ([]*HabitEntry, error)
+	GetHabitEntriesByUser(habitID, userID uuid.UUID) ([]*HabitEntry, error)
+	GetHabitVersions(habitID uuid.UUID) ([]*HabitVersion, error)
+	AddPause(*HabitPause) (*HabitPause, error)
+	GetPauses(habitID uuid.UUID) ([]*HabitPause, error)
+	DeletePause(habitID, pauseID uuid.UUID) error
+	AddSkip(*HabitSkip) (*HabitSkip, error)
+	GetSkips(habitID uuid.UUID) ([]*HabitSkip, error)
+	DeleteSkip(habitID, skipID uuid.UUID) error
 	AddTagToHabit(habitID, tagID uuid.UUID) error
 	RemoveTagFromHabit(habitID, tagID uuid.UUID) error
-	GetHabitsByTag(tagID uuid.UUID) ([]*Habit, error)
+	GetHabitsByTag(tagID, userID uuid.UUID) ([]*Habit, error)
+	AddHabitLink(habitID, afterHabitID uuid.UUID) (*HabitLink, error)
+	GetHabitLinks(habitID uuid.UUID) ([]*HabitLink, error)
+	GetAllHabitLinks() ([]*HabitLink, error)
+	RemoveHabitLink(habitID, linkID uuid.UUID) error
 }
 
 func (pg *PostgresHabitStore) CreateHabit(habit *Habit) (*Habit, error) {
-	habit.ID = uuid.New()
-
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	query := `
-		INSERT INTO habits (id, name, description, frequency, target_count, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id`
-
-	err = tx.QueryRow(query, habit.ID, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, habit.IsActive).Scan(&habit.ID)
+	err = insertHabit(tx, habit)
 	if err != nil {
 		return nil, err
 	}
@@ -79,15 +168,81 @@ func (pg *PostgresHabitStore) CreateHabit(habit *Habit) (*Habit, error) {
 	return habit, nil
 }
 
+// insertHabit is the shared write path for CreateHabit and anything else that
+// creates habits as part of a larger transaction.
+func insertHabit(tx *sql.Tx, habit *Habit) error {
+	habit.ID = uuid.New()
+	if habit.Polarity == "" {
+		habit.Polarity = PolarityBuild
+	}
+
+	query := `
+		INSERT INTO habits (id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id`
+
+	err := tx.QueryRow(query, habit.ID, habit.UserID, habit.GroupID, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, habit.Unit, habit.TargetAmount, habit.TargetDurationSeconds, habit.Polarity, habit.IsActive, habit.FreezesPerMonth).Scan(&habit.ID)
+	if err != nil {
+		return err
+	}
+
+	return recordHabitVersion(tx, habit.ID)
+}
+
+// recordHabitVersion snapshots the habit's name, frequency and targets into
+// habit_versions, effective from its updated_at. Nothing is written when
+// none of those fields changed since the latest version.
+func recordHabitVersion(tx *sql.Tx, habitID uuid.UUID) error {
+	query := `
+		INSERT INTO habit_versions (id, habit_id, name, frequency, target_count, target_amount, target_duration_seconds, effective_from)
+		SELECT $1, h.id, h.name, h.frequency, h.target_count, h.target_amount, h.target_duration_seconds, h.updated_at
+		FROM habits h
+		LEFT JOIN LATERAL (
+			SELECT name, frequency, target_count, target_amount, target_duration_seconds
+			FROM habit_versions
+			WHERE habit_id = h.id
+			ORDER BY effective_from DESC
+			LIMIT 1
+		) v ON TRUE
+		WHERE h.id = $2 AND (v.name IS NULL OR
+			(h.name, h.frequency, h.target_count, h.target_amount, h.target_duration_seconds) IS DISTINCT FROM
+			(v.name, v.frequency, v.target_count, v.target_amount, v.target_duration_seconds))`
+
+	_, err := tx.Exec(query, uuid.New(), habitID)
+	return err
+}
+
 func (pg *PostgresHabitStore) GetHabitByID(id uuid.UUID) (*Habit, error) {
 	habit := &Habit{}
 
 	query := `
-		SELECT id, name, description, frequency, target_count, is_active, created_at, updated_at
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month, created_at, updated_at, archived_at
+		FROM habits
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	err := pg.db.QueryRow(query, id).Scan(&habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.Unit, &habit.TargetAmount, &habit.TargetDurationSeconds, &habit.Polarity, &habit.IsActive, &habit.FreezesPerMonth, &habit.CreatedAt, &habit.UpdatedAt, &habit.ArchivedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return habit, nil
+}
+
+// GetHabitIncludingTrashed is GetHabitByID but also finds habits in the
+// trash, with DeletedAt set, so access checks cover restoring them.
+func (pg *PostgresHabitStore) GetHabitIncludingTrashed(id uuid.UUID) (*Habit, error) {
+	habit := &Habit{}
+
+	query := `
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month, created_at, updated_at, archived_at, deleted_at
 		FROM habits
 		WHERE id = $1`
 
-	err := pg.db.QueryRow(query, id).Scan(&habit.ID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.IsActive, &habit.CreatedAt, &habit.UpdatedAt)
+	err := pg.db.QueryRow(query, id).Scan(&habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.Unit, &habit.TargetAmount, &habit.TargetDurationSeconds, &habit.Polarity, &habit.IsActive, &habit.FreezesPerMonth, &habit.CreatedAt, &habit.UpdatedAt, &habit.ArchivedAt, &habit.DeletedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -99,13 +254,88 @@ func (pg *PostgresHabitStore) GetHabitByID(id uuid.UUID) (*Habit, error) {
 	return habit, nil
 }
 
-func (pg *PostgresHabitStore) GetHabits() ([]*Habit, error) {
+// visibleTo limits a habits query to the ones user $1 may list: their own,
+// their groups' and the ownerless habits that predate accounts.
+const visibleTo = `
+		AND ((user_id IS NULL AND group_id IS NULL) OR user_id = $1 OR group_id IN (
+			SELECT group_id FROM group_members WHERE user_id = $1
+		))`
+
+// managedBy, loggableBy and readableBy limit a habits query, aliased h, to
+// the habits user $2 may manage, log or read. They match the habit access
+// checks in the api package: accepted partners only read.
+const (
+	managedBy = `
+		AND ((h.user_id IS NULL AND h.group_id IS NULL) OR h.user_id = $2 OR h.group_id IN (
+			SELECT group_id FROM group_members WHERE user_id = $2 AND role IN ('owner', 'admin')
+		))`
+	loggableBy = `
+		AND ((h.user_id IS NULL AND h.group_id IS NULL) OR h.user_id = $2 OR h.group_id IN (
+			SELECT group_id FROM group_members WHERE user_id = $2
+		))`
+	readableBy = `
+		AND ((h.user_id IS NULL AND h.group_id IS NULL) OR h.user_id = $2 OR h.group_id IN (
+			SELECT group_id FROM group_members WHERE user_id = $2
+		) OR h.id IN (
+			SELECT habit_id FROM habit_partners WHERE partner_id = $2 AND status = 'accepted'
+		))`
+)
+
+// GetHabitsForUser returns the active habits userID may list.
+func (pg *PostgresHabitStore) GetHabitsForUser(userID uuid.UUID) ([]*Habit, error) {
 	query := `
-		SELECT id, name, description, frequency, target_count, is_active, created_at, updated_at
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month, created_at, updated_at, archived_at
 		FROM habits
+		WHERE deleted_at IS NULL AND archived_at IS NULL` + visibleTo + `
 		ORDER BY name`
 
-	rows, err := pg.db.Query(query)
+	return pg.queryHabits(query, userID)
+}
+
+// GetArchivedHabitsForUser returns the archived habits userID may list,
+// most recently archived first.
+func (pg *PostgresHabitStore) GetArchivedHabitsForUser(userID uuid.UUID) ([]*Habit, error) {
+	query := `
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month, created_at, updated_at, archived_at
+		FROM habits
+		WHERE deleted_at IS NULL AND archived_at IS NOT NULL` + visibleTo + `
+		ORDER BY archived_at DESC`
+
+	return pg.queryHabits(query, userID)
+}
+
+// GetGroupHabits returns the active habits owned by a group.
+func (pg *PostgresHabitStore) GetGroupHabits(groupID uuid.UUID) ([]*Habit, error) {
+	query := `
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, freezes_per_month, created_at, updated_at, archived_at
+		FROM habits
+		WHERE group_id = $1 AND deleted_at IS NULL AND archived_at IS NULL
+		ORDER BY name`
+
+	return pg.queryHabits(query, groupID)
+}
+
+// GetHabitGroupRole returns userID's role in the group that owns the habit.
+// It is empty when the habit has no group or the user isn't a member.
+func (pg *PostgresHabitStore) GetHabitGroupRole(habitID, userID uuid.UUID) (string, error) {
+	var role string
+
+	query := `
+		SELECT gm.role
+		FROM habits h
+		INNER JOIN group_members gm ON gm.group_id = h.group_id
+		WHERE h.id = $1 AND gm.user_id = $2`
+
+	err := pg.db.QueryRow(query, habitID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return role, err
+}
+
+func (pg *PostgresHabitStore) queryHabits(query string, args ...any) ([]*Habit, error) {
+	rows, err := pg.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +344,7 @@ func (pg *PostgresHabitStore) GetHabits() ([]*Habit, error) {
 	var habits []*Habit
 	for rows.Next() {
 		habit := &Habit{}
-		err := rows.Scan(&habit.ID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.IsActive, &habit.CreatedAt, &habit.UpdatedAt)
+		err := rows.Scan(&habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.Unit, &habit.TargetAmount, &habit.TargetDurationSeconds, &habit.Polarity, &habit.IsActive, &habit.FreezesPerMonth, &habit.CreatedAt, &habit.UpdatedAt, &habit.ArchivedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -136,11 +366,11 @@ func (pg *PostgresHabitStore) UpdateHabit(habit *Habit) error {
 	defer tx.Rollback()
 
 	query := `UPDATE habits
-		SET name = $1, description = $2, frequency = $3, target_count = $4, is_active = $5, updated_at = $6
-		WHERE id = $7
+		SET name = $1, description = $2, frequency = $3, target_count = $4, unit = $5, target_amount = $6, target_duration_seconds = $7, polarity = $8, is_active = $9, freezes_per_month = $10, updated_at = $11
+		WHERE id = $12 AND deleted_at IS NULL
 	`
 
-	result, err := tx.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, habit.IsActive, time.Now(), habit.ID)
+	result, err := tx.Exec(query, habit.Name, habit.Description, habit.Frequency, habit.TargetCount, habit.Unit, habit.TargetAmount, habit.TargetDurationSeconds, habit.Polarity, habit.IsActive, habit.FreezesPerMonth, time.Now(), habit.ID)
 	if err != nil {
 		return err
 	}
@@ -154,15 +384,123 @@ func (pg *PostgresHabitStore) UpdateHabit(habit *Habit) error {
 		return sql.ErrNoRows
 	}
 
+	err = recordHabitVersion(tx, habit.ID)
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+// DeleteHabit moves a habit to the trash. Its entries and tags are kept until
+// the habit is purged, so RestoreHabit brings back its full history.
 func (pg *PostgresHabitStore) DeleteHabit(id uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		DELETE from habits
-		WHERE id = $1`
+		UPDATE habits
+		SET deleted_at = $1, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL`
 
-	result, err := pg.db.Exec(query, id)
+	result, err := tx.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Offline clients drop a trashed habit and its entries until it is restored.
+	err = tombstoneHabitEntries(tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = recordTombstone(tx, "habit", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresHabitStore) RestoreHabit(id uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE habits
+		SET deleted_at = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NOT NULL`
+
+	result, err := tx.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	// Touching the entries bumps their sync version so clients pull them again.
+	_, err = tx.Exec(`UPDATE habit_entries SET updated_at = updated_at WHERE habit_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveHabit retires a finished habit. Archived habits drop out of lists but
+// keep their entries, so stats and exports still cover them.
+func (pg *PostgresHabitStore) ArchiveHabit(id uuid.UUID) error {
+	query := `
+		UPDATE habits
+		SET archived_at = $1, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL AND archived_at IS NULL`
+
+	result, err := pg.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresHabitStore) UnarchiveHabit(id uuid.UUID) error {
+	query := `
+		UPDATE habits
+		SET archived_at = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL AND archived_at IS NOT NULL`
+
+	result, err := pg.db.Exec(query, time.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -190,13 +528,85 @@ func (pg *PostgresHabitStore) LogHabit(habitEntry *HabitEntry) (*HabitEntry, err
 	}
 	defer tx.Rollback()
 
+	err = insertHabitEntry(tx, habitEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return habitEntry, nil
+}
+
+// insertHabitEntry is the shared write path for LogHabit and anything else
+// that records completions as part of a larger transaction.
+func insertHabitEntry(tx *sql.Tx, habitEntry *HabitEntry) error {
+	if habitEntry.Value <= 0 {
+		return errors.New("entry value must be greater than zero")
+	}
+
+	if habitEntry.DurationSeconds < 0 {
+		return errors.New("entry duration cannot be negative")
+	}
+
 	habitEntry.ID = uuid.New()
+
 	query := `
-		INSERT INTO habit_entries (id, habit_id, completion_date, note)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, habit_id, completion_date, note`
+		INSERT INTO habit_entries (id, habit_id, completion_date, value, duration_seconds, note, completed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, habit_id, completion_date, value, duration_seconds, note, completed_by, updated_at`
+
+	return tx.QueryRow(query, habitEntry.ID, habitEntry.HabitID, time.Now(), habitEntry.Value, habitEntry.DurationSeconds, habitEntry.Note, habitEntry.CompletedBy).Scan(&habitEntry.ID, &habitEntry.HabitID, &habitEntry.Completion, &habitEntry.Value, &habitEntry.DurationSeconds, &habitEntry.Note, &habitEntry.CompletedBy, &habitEntry.UpdatedAt)
+}
+
+func (pg *PostgresHabitStore) StartTimer(habitID uuid.UUID, userID *uuid.UUID) (*HabitTimer, error) {
+	timer := &HabitTimer{HabitID: habitID, UserID: userID}
+
+	query := `
+		INSERT INTO habit_timers (habit_id, user_id, started_at)
+		VALUES ($1, $2, $3)
+		RETURNING started_at`
+
+	err := pg.db.QueryRow(query, habitID, userID, time.Now()).Scan(&timer.StartedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, errors.New("timer already running")
+		}
+		return nil, err
+	}
+
+	return timer, nil
+}
+
+// StopTimer ends userID's running timer for a habit and logs an entry by them
+// carrying the elapsed time, in the same transaction so a session is never
+// lost or counted twice.
+func (pg *PostgresHabitStore) StopTimer(habitID uuid.UUID, note string, userID *uuid.UUID) (*HabitEntry, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var startedAt time.Time
+	err = tx.QueryRow(`DELETE FROM habit_timers WHERE habit_id = $1 AND user_id IS NOT DISTINCT FROM $2 RETURNING started_at`, habitID, userID).Scan(&startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// The clock may have been set back while the timer ran.
+	habitEntry := &HabitEntry{
+		HabitID:         habitID,
+		Value:           1,
+		DurationSeconds: max(int(time.Since(startedAt).Seconds()), 0),
+		Note:            note,
+		CompletedBy:     userID,
+	}
 
-	err = tx.QueryRow(query, habitEntry.ID, habitEntry.HabitID, time.Now(), habitEntry.Note).Scan(&habitEntry.ID, &habitEntry.HabitID, &habitEntry.Completion, &habitEntry.Note)
+	err = insertHabitEntry(tx, habitEntry)
 	if err != nil {
 		return nil, err
 	}
@@ -209,6 +619,237 @@ func (pg *PostgresHabitStore) LogHabit(habitEntry *HabitEntry) (*HabitEntry, err
 	return habitEntry, nil
 }
 
+func (pg *PostgresHabitStore) GetHabitEntries(habitID uuid.UUID) ([]*HabitEntry, error) {
+	query := `
+		SELECT id, habit_id, completion_date, value, duration_seconds, note, completed_by, updated_at
+		FROM habit_entries
+		WHERE habit_id = $1
+		ORDER BY completion_date`
+
+	rows, err := pg.db.Query(query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*HabitEntry
+	for rows.Next() {
+		entry := &HabitEntry{}
+		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.Completion, &entry.Value, &entry.DurationSeconds, &entry.Note, &entry.CompletedBy, &entry.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetHabitEntriesByUser returns the entries userID logged on a habit. Entries
+// from before completed_by was recorded count for the habit's owner.
+func (pg *PostgresHabitStore) GetHabitEntriesByUser(habitID, userID uuid.UUID) ([]*HabitEntry, error) {
+	query := `
+		SELECT he.id, he.habit_id, he.completion_date, he.value, he.duration_seconds, he.note, he.completed_by, he.updated_at
+		FROM habit_entries he
+		INNER JOIN habits h ON h.id = he.habit_id
+		WHERE he.habit_id = $1 AND (he.completed_by = $2 OR (he.completed_by IS NULL AND h.user_id = $2))
+		ORDER BY he.completion_date`
+
+	rows, err := pg.db.Query(query, habitID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*HabitEntry
+	for rows.Next() {
+		entry := &HabitEntry{}
+		err := rows.Scan(&entry.ID, &entry.HabitID, &entry.Completion, &entry.Value, &entry.DurationSeconds, &entry.Note, &entry.CompletedBy, &entry.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetHabitVersions returns a habit's versions, oldest first.
+func (pg *PostgresHabitStore) GetHabitVersions(habitID uuid.UUID) ([]*HabitVersion, error) {
+	query := `
+		SELECT id, habit_id, name, frequency, COALESCE(target_count, 1), target_amount, target_duration_seconds, effective_from
+		FROM habit_versions
+		WHERE habit_id = $1
+		ORDER BY effective_from`
+
+	rows, err := pg.db.Query(query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*HabitVersion
+	for rows.Next() {
+		version := &HabitVersion{}
+		err := rows.Scan(&version.ID, &version.HabitID, &version.Name, &version.Frequency, &version.TargetCount, &version.TargetAmount, &version.TargetDurationSeconds, &version.EffectiveFrom)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (pg *PostgresHabitStore) AddPause(pause *HabitPause) (*HabitPause, error) {
+	pause.ID = uuid.New()
+
+	query := `
+		INSERT INTO habit_pauses (id, habit_id, start_date, end_date, reason)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := pg.db.Exec(query, pause.ID, pause.HabitID, pause.StartDate, pause.EndDate, pause.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return pause, nil
+}
+
+func (pg *PostgresHabitStore) GetPauses(habitID uuid.UUID) ([]*HabitPause, error) {
+	query := `
+		SELECT id, habit_id, start_date, end_date, reason
+		FROM habit_pauses
+		WHERE habit_id = $1
+		ORDER BY start_date`
+
+	rows, err := pg.db.Query(query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pauses []*HabitPause
+	for rows.Next() {
+		pause := &HabitPause{}
+		err := rows.Scan(&pause.ID, &pause.HabitID, &pause.StartDate, &pause.EndDate, &pause.Reason)
+		if err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, pause)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pauses, nil
+}
+
+func (pg *PostgresHabitStore) DeletePause(habitID, pauseID uuid.UUID) error {
+	query := `
+		DELETE FROM habit_pauses
+		WHERE id = $1 AND habit_id = $2`
+
+	result, err := pg.db.Exec(query, pauseID, habitID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresHabitStore) AddSkip(skip *HabitSkip) (*HabitSkip, error) {
+	skip.ID = uuid.New()
+
+	query := `
+		INSERT INTO habit_skips (id, habit_id, skip_date, reason)
+		VALUES ($1, $2, $3, $4)`
+
+	_, err := pg.db.Exec(query, skip.ID, skip.HabitID, skip.SkipDate, skip.Reason)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, errors.New("day already skipped")
+		}
+		return nil, err
+	}
+
+	return skip, nil
+}
+
+func (pg *PostgresHabitStore) GetSkips(habitID uuid.UUID) ([]*HabitSkip, error) {
+	query := `
+		SELECT id, habit_id, skip_date, reason
+		FROM habit_skips
+		WHERE habit_id = $1
+		ORDER BY skip_date`
+
+	rows, err := pg.db.Query(query, habitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var skips []*HabitSkip
+	for rows.Next() {
+		skip := &HabitSkip{}
+		err := rows.Scan(&skip.ID, &skip.HabitID, &skip.SkipDate, &skip.Reason)
+		if err != nil {
+			return nil, err
+		}
+		skips = append(skips, skip)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return skips, nil
+}
+
+func (pg *PostgresHabitStore) DeleteSkip(habitID, skipID uuid.UUID) error {
+	query := `
+		DELETE FROM habit_skips
+		WHERE id = $1 AND habit_id = $2`
+
+	result, err := pg.db.Exec(query, skipID, habitID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (pg *PostgresHabitStore) AddTagToHabit(habitID, tagID uuid.UUID) error {
 	query := `
         INSERT INTO habit_tags (id, habit_id, tag_id)
@@ -240,36 +881,143 @@ func (pg *PostgresHabitStore) RemoveTagFromHabit(habitID, tagID uuid.UUID) error
 	return nil
 }
 
-func (pg *PostgresHabitStore) GetHabitsByTag(tagID uuid.UUID) ([]*Habit, error) {
+// GetHabitsByTag returns the tagged habits userID may list.
+func (pg *PostgresHabitStore) GetHabitsByTag(tagID, userID uuid.UUID) ([]*Habit, error) {
 	query := `
-		SELECT DISTINCT h.id, h.name, h.description, h.frequency, h.target_count, h.is_active, h.created_at, h.updated_at
+		SELECT DISTINCT h.id, h.user_id, h.group_id, h.name, h.description, h.frequency, h.target_count, h.unit, h.target_amount, h.target_duration_seconds, h.polarity, h.is_active, h.freezes_per_month, h.created_at, h.updated_at, h.archived_at
 		FROM habits h
 		INNER JOIN habit_tags ht ON h.id = ht.habit_id
-		WHERE ht.tag_id = $1
+		WHERE ht.tag_id = $1 AND h.deleted_at IS NULL AND h.archived_at IS NULL
+			AND ((h.user_id IS NULL AND h.group_id IS NULL) OR h.user_id = $2 OR h.group_id IN (
+				SELECT group_id FROM group_members WHERE user_id = $2
+			))
 		ORDER BY h.name`
 
-	rows, err := pg.db.Query(query, tagID)
+	return pg.queryHabits(query, tagID, userID)
+}
+
+// AddHabitLink stacks habitID after afterHabitID. It refuses links that would
+// make a habit (transitively) wait on itself.
+func (pg *PostgresHabitStore) AddHabitLink(habitID, afterHabitID uuid.UUID) (*HabitLink, error) {
+	if habitID == afterHabitID {
+		return nil, errors.New("habit cannot stack after itself")
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialise link creation so two concurrent requests can't close a cycle.
+	_, err = tx.Exec(`LOCK TABLE habit_links IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return nil, err
+	}
+
+	cycleQuery := `
+		WITH RECURSIVE chain (id) AS (
+			SELECT after_habit_id FROM habit_links WHERE habit_id = $1
+			UNION
+			SELECT hl.after_habit_id FROM habit_links hl INNER JOIN chain c ON hl.habit_id = c.id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $2)`
+
+	var createsCycle bool
+	err = tx.QueryRow(cycleQuery, afterHabitID, habitID).Scan(&createsCycle)
+	if err != nil {
+		return nil, err
+	}
+
+	if createsCycle {
+		return nil, errors.New("habit link would create a cycle")
+	}
+
+	link := &HabitLink{ID: uuid.New(), HabitID: habitID, AfterHabitID: afterHabitID}
+
+	query := `
+		INSERT INTO habit_links (id, habit_id, after_habit_id)
+		VALUES ($1, $2, $3)
+		RETURNING created_at`
+
+	err = tx.QueryRow(query, link.ID, link.HabitID, link.AfterHabitID).Scan(&link.CreatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, errors.New("habit link already exists")
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// GetHabitLinks returns the links on either side of a habit.
+func (pg *PostgresHabitStore) GetHabitLinks(habitID uuid.UUID) ([]*HabitLink, error) {
+	query := `
+		SELECT id, habit_id, after_habit_id, created_at
+		FROM habit_links
+		WHERE habit_id = $1 OR after_habit_id = $1
+		ORDER BY created_at`
+
+	return pg.queryHabitLinks(query, habitID)
+}
+
+func (pg *PostgresHabitStore) GetAllHabitLinks() ([]*HabitLink, error) {
+	query := `
+		SELECT id, habit_id, after_habit_id, created_at
+		FROM habit_links
+		ORDER BY created_at`
+
+	return pg.queryHabitLinks(query)
+}
+
+func (pg *PostgresHabitStore) queryHabitLinks(query string, args ...any) ([]*HabitLink, error) {
+	rows, err := pg.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var habits []*Habit
+	var links []*HabitLink
 	for rows.Next() {
-		habit := &Habit{}
-		err := rows.Scan(
-			&habit.ID, &habit.Name, &habit.Description, &habit.Frequency,
-			&habit.TargetCount, &habit.IsActive, &habit.CreatedAt, &habit.UpdatedAt,
-		)
+		link := &HabitLink{}
+		err := rows.Scan(&link.ID, &link.HabitID, &link.AfterHabitID, &link.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
-		habits = append(habits, habit)
+		links = append(links, link)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return habits, nil
+	return links, nil
+}
+
+func (pg *PostgresHabitStore) RemoveHabitLink(habitID, linkID uuid.UUID) error {
+	query := `
+		DELETE FROM habit_links
+		WHERE id = $1 AND (habit_id = $2 OR after_habit_id = $2)`
+
+	result, err := pg.db.Exec(query, linkID, habitID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// PostgresIdentityStore links local users to accounts at external OpenID
+// Connect providers, keyed by the provider's issuer and subject.
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{db: db}
+}
+
+type IdentityStore interface {
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	LinkIdentity(userID uuid.UUID, issuer, subject string) error
+}
+
+// GetUserByIdentity returns the user linked to the external account, or nil
+// when it hasn't been linked yet.
+func (pg *PostgresIdentityStore) GetUserByIdentity(issuer, subject string) (*User, error) {
+	query := userColumns + `
+		FROM users u
+		INNER JOIN user_identities ui ON ui.user_id = u.id
+		WHERE ui.issuer = $1 AND ui.subject = $2`
+
+	return scanUser(pg.db.QueryRow(query, issuer, subject))
+}
+
+// LinkIdentity attaches an external account to a user. Linking an account
+// that is already linked leaves the existing link alone.
+func (pg *PostgresIdentityStore) LinkIdentity(userID uuid.UUID, issuer, subject string) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (issuer, subject) DO NOTHING`
+
+	_, err := pg.db.Exec(query, issuer, subject, userID)
+	return err
+}
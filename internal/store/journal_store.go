@@ -0,0 +1,162 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JournalEntry is a free-text note for a calendar day, with optional mood and
+// energy ratings from 1 to 5. Each user has at most one per day.
+type JournalEntry struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Date      time.Time
+	Body      string
+	Mood      *int
+	Energy    *int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ValidRating reports whether an optional mood or energy rating is in range.
+func ValidRating(rating *int) bool {
+	return rating == nil || (*rating >= 1 && *rating <= 5)
+}
+
+type PostgresJournalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresJournalStore(db *sql.DB) *PostgresJournalStore {
+	return &PostgresJournalStore{db: db}
+}
+
+type JournalStore interface {
+	CreateJournalEntry(*JournalEntry) (*JournalEntry, error)
+	GetJournalEntryByDate(userID uuid.UUID, date time.Time) (*JournalEntry, error)
+	GetJournalEntries(userID uuid.UUID, from, to time.Time) ([]*JournalEntry, error)
+	UpdateJournalEntry(*JournalEntry) error
+	DeleteJournalEntry(userID uuid.UUID, date time.Time) error
+}
+
+func (pg *PostgresJournalStore) CreateJournalEntry(entry *JournalEntry) (*JournalEntry, error) {
+	entry.ID = uuid.New()
+
+	query := `
+		INSERT INTO journal_entries (id, user_id, entry_date, body, mood, energy)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at, updated_at`
+
+	err := pg.db.QueryRow(query, entry.ID, entry.UserID, entry.Date, entry.Body, entry.Mood, entry.Energy).Scan(&entry.CreatedAt, &entry.UpdatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return nil, errors.New("journal entry for this date already exists")
+		}
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (pg *PostgresJournalStore) GetJournalEntryByDate(userID uuid.UUID, date time.Time) (*JournalEntry, error) {
+	entry := &JournalEntry{}
+
+	query := `
+		SELECT id, user_id, entry_date, body, mood, energy, created_at, updated_at
+		FROM journal_entries
+		WHERE user_id = $1 AND entry_date = $2`
+
+	err := pg.db.QueryRow(query, userID, date).Scan(&entry.ID, &entry.UserID, &entry.Date, &entry.Body, &entry.Mood, &entry.Energy, &entry.CreatedAt, &entry.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetJournalEntries returns the user's entries dated from to to, inclusive,
+// oldest first. A zero bound leaves that side open.
+func (pg *PostgresJournalStore) GetJournalEntries(userID uuid.UUID, from, to time.Time) ([]*JournalEntry, error) {
+	query := `
+		SELECT id, user_id, entry_date, body, mood, energy, created_at, updated_at
+		FROM journal_entries
+		WHERE user_id = $1 AND ($2::date IS NULL OR entry_date >= $2) AND ($3::date IS NULL OR entry_date <= $3)
+		ORDER BY entry_date`
+
+	rows, err := pg.db.Query(query, userID, nullDate(from), nullDate(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*JournalEntry{}
+	for rows.Next() {
+		entry := &JournalEntry{}
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Date, &entry.Body, &entry.Mood, &entry.Energy, &entry.CreatedAt, &entry.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (pg *PostgresJournalStore) UpdateJournalEntry(entry *JournalEntry) error {
+	query := `UPDATE journal_entries
+		SET body = $1, mood = $2, energy = $3, updated_at = $4
+		WHERE id = $5 AND user_id = $6
+		RETURNING updated_at
+	`
+
+	err := pg.db.QueryRow(query, entry.Body, entry.Mood, entry.Energy, time.Now(), entry.ID, entry.UserID).Scan(&entry.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteJournalEntry removes the user's entry for a day and leaves a
+// tombstone so sync clients drop it too.
+func (pg *PostgresJournalStore) DeleteJournalEntry(userID uuid.UUID, date time.Time) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id uuid.UUID
+	err = tx.QueryRow(`SELECT id FROM journal_entries WHERE user_id = $1 AND entry_date = $2 FOR UPDATE`, userID, date).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	err = recordTombstone(tx, "journal", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM journal_entries WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PartnerPending  = "pending"
+	PartnerAccepted = "accepted"
+	PartnerDeclined = "declined"
+)
+
+// HabitPartner lets PartnerID follow OwnerID's progress on one habit. Only
+// accepted partners can see the habit; revoking deletes the row.
+type HabitPartner struct {
+	ID          uuid.UUID
+	HabitID     uuid.UUID
+	OwnerID     uuid.UUID
+	PartnerID   uuid.UUID
+	Status      string
+	CreatedAt   time.Time
+	RespondedAt *time.Time
+}
+
+// Nudge is a reminder a partner sent to a habit's owner.
+type Nudge struct {
+	ID         uuid.UUID
+	HabitID    uuid.UUID
+	FromUserID uuid.UUID
+	ToUserID   uuid.UUID
+	Message    string
+	CreatedAt  time.Time
+}
+
+type PostgresPartnerStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPartnerStore(db *sql.DB) *PostgresPartnerStore {
+	return &PostgresPartnerStore{db: db}
+}
+
+type PartnerStore interface {
+	InvitePartner(*HabitPartner) (*HabitPartner, error)
+	GetHabitPartners(habitID uuid.UUID) ([]*HabitPartner, error)
+	GetPartnershipsForUser(userID uuid.UUID, status string) ([]*HabitPartner, error)
+	RespondToInvitation(id, partnerID uuid.UUID, accept bool) (*HabitPartner, error)
+	RevokePartner(id, userID uuid.UUID) error
+	IsPartner(habitID, userID uuid.UUID) (bool, error)
+	CreateNudge(*Nudge) (*Nudge, error)
+	GetNudges(userID uuid.UUID) ([]*Nudge, error)
+}
+
+// InvitePartner creates a pending invitation. Inviting someone who declined
+// before reopens their invitation.
+func (pg *PostgresPartnerStore) InvitePartner(partner *HabitPartner) (*HabitPartner, error) {
+	partner.ID = uuid.New()
+	partner.Status = PartnerPending
+
+	query := `
+		INSERT INTO habit_partners (id, habit_id, owner_id, partner_id, status)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (habit_id, partner_id) DO UPDATE
+		SET status = EXCLUDED.status, created_at = CURRENT_TIMESTAMP, responded_at = NULL
+		WHERE habit_partners.status = 'declined'
+		RETURNING id, created_at`
+
+	err := pg.db.QueryRow(query, partner.ID, partner.HabitID, partner.OwnerID, partner.PartnerID, partner.Status).Scan(&partner.ID, &partner.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user is already a partner on this habit")
+	}
+
+	if err != nil {
+		if strings.Contains(err.Error(), "violates check constraint") {
+			return nil, errors.New("you cannot partner with yourself")
+		}
+		return nil, err
+	}
+
+	return partner, nil
+}
+
+func (pg *PostgresPartnerStore) GetHabitPartners(habitID uuid.UUID) ([]*HabitPartner, error) {
+	query := `
+		SELECT id, habit_id, owner_id, partner_id, status, created_at, responded_at
+		FROM habit_partners
+		WHERE habit_id = $1
+		ORDER BY created_at`
+
+	return pg.queryPartners(query, habitID)
+}
+
+// GetPartnershipsForUser returns the partnerships where userID is the
+// partner, limited to one status.
+func (pg *PostgresPartnerStore) GetPartnershipsForUser(userID uuid.UUID, status string) ([]*HabitPartner, error) {
+	query := `
+		SELECT id, habit_id, owner_id, partner_id, status, created_at, responded_at
+		FROM habit_partners
+		WHERE partner_id = $1 AND status = $2
+		ORDER BY created_at`
+
+	return pg.queryPartners(query, userID, status)
+}
+
+func (pg *PostgresPartnerStore) queryPartners(query string, args ...any) ([]*HabitPartner, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partners := []*HabitPartner{}
+	for rows.Next() {
+		partner := &HabitPartner{}
+		err := rows.Scan(&partner.ID, &partner.HabitID, &partner.OwnerID, &partner.PartnerID, &partner.Status, &partner.CreatedAt, &partner.RespondedAt)
+		if err != nil {
+			return nil, err
+		}
+		partners = append(partners, partner)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return partners, nil
+}
+
+// RespondToInvitation accepts or declines a pending invitation addressed to
+// partnerID. It returns sql.ErrNoRows when there is no such invitation.
+func (pg *PostgresPartnerStore) RespondToInvitation(id, partnerID uuid.UUID, accept bool) (*HabitPartner, error) {
+	status := PartnerDeclined
+	if accept {
+		status = PartnerAccepted
+	}
+
+	partner := &HabitPartner{}
+
+	query := `
+		UPDATE habit_partners
+		SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND partner_id = $3 AND status = 'pending'
+		RETURNING id, habit_id, owner_id, partner_id, status, created_at, responded_at`
+
+	err := pg.db.QueryRow(query, status, id, partnerID).Scan(&partner.ID, &partner.HabitID, &partner.OwnerID, &partner.PartnerID, &partner.Status, &partner.CreatedAt, &partner.RespondedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return partner, nil
+}
+
+// RevokePartner ends a partnership. Either the owner or the partner may do so.
+func (pg *PostgresPartnerStore) RevokePartner(id, userID uuid.UUID) error {
+	query := `
+		DELETE FROM habit_partners
+		WHERE id = $1 AND (owner_id = $2 OR partner_id = $2)`
+
+	result, err := pg.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// IsPartner reports whether userID is an accepted partner on the habit.
+func (pg *PostgresPartnerStore) IsPartner(habitID, userID uuid.UUID) (bool, error) {
+	var exists bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM habit_partners
+			WHERE habit_id = $1 AND partner_id = $2 AND status = 'accepted'
+		)`
+
+	err := pg.db.QueryRow(query, habitID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (pg *PostgresPartnerStore) CreateNudge(nudge *Nudge) (*Nudge, error) {
+	nudge.ID = uuid.New()
+
+	query := `
+		INSERT INTO habit_nudges (id, habit_id, from_user_id, to_user_id, message)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`
+
+	err := pg.db.QueryRow(query, nudge.ID, nudge.HabitID, nudge.FromUserID, nudge.ToUserID, nudge.Message).Scan(&nudge.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return nudge, nil
+}
+
+// GetNudges returns the nudges sent to userID, newest first.
+func (pg *PostgresPartnerStore) GetNudges(userID uuid.UUID) ([]*Nudge, error) {
+	query := `
+		SELECT id, habit_id, from_user_id, to_user_id, message, created_at
+		FROM habit_nudges
+		WHERE to_user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nudges := []*Nudge{}
+	for rows.Next() {
+		nudge := &Nudge{}
+		err := rows.Scan(&nudge.ID, &nudge.HabitID, &nudge.FromUserID, &nudge.ToUserID, &nudge.Message, &nudge.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		nudges = append(nudges, nudge)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nudges, nil
+}
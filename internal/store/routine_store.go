@@ -0,0 +1,339 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Routine is an ordered group of habits that are meant to be done in sequence,
+// like a morning routine. Its habits are ones its owner may log.
+type Routine struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Name        string
+	Description string
+	Habits      []*Habit
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RoutineStep is one member habit of a routine together with whether it has
+// already been logged in the requested window.
+type RoutineStep struct {
+	Position  int
+	Habit     *Habit
+	Completed bool
+}
+
+type PostgresRoutineStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRoutineStore(db *sql.DB) *PostgresRoutineStore {
+	return &PostgresRoutineStore{db: db}
+}
+
+type RoutineStore interface {
+	CreateRoutine(routine *Routine, habitIDs []uuid.UUID) (*Routine, error)
+	GetRoutineByID(userID, id uuid.UUID) (*Routine, error)
+	GetRoutines(userID uuid.UUID) ([]*Routine, error)
+	UpdateRoutine(routine *Routine, habitIDs []uuid.UUID) error
+	DeleteRoutine(userID, id uuid.UUID) error
+	GetRoutineProgress(userID, id uuid.UUID, from, to time.Time) ([]*RoutineStep, error)
+	CompleteRoutine(userID, id uuid.UUID, from, to time.Time, note string) ([]*HabitEntry, error)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func (pg *PostgresRoutineStore) CreateRoutine(routine *Routine, habitIDs []uuid.UUID) (*Routine, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	routine.ID = uuid.New()
+	query := `
+		INSERT INTO routines (id, user_id, name, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, updated_at`
+
+	err = tx.QueryRow(query, routine.ID, routine.UserID, routine.Name, routine.Description).Scan(&routine.CreatedAt, &routine.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setRoutineHabits(tx, routine.UserID, routine.ID, habitIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.GetRoutineByID(routine.UserID, routine.ID)
+}
+
+// setRoutineHabits replaces a routine's members, keeping the order of habitIDs.
+// Habits userID may not log are reported as not found.
+func setRoutineHabits(tx *sql.Tx, userID, routineID uuid.UUID, habitIDs []uuid.UUID) error {
+	_, err := tx.Exec(`DELETE FROM routine_habits WHERE routine_id = $1`, routineID)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for i, habitID := range habitIDs {
+		if seen[habitID] {
+			return errors.New("habit listed twice in routine")
+		}
+		seen[habitID] = true
+
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM habits h WHERE h.id = $1 AND h.deleted_at IS NULL`+loggableBy+`)`, habitID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("routine habit not found")
+		}
+
+		query := `
+			INSERT INTO routine_habits (id, routine_id, habit_id, position)
+			VALUES ($1, $2, $3, $4)`
+
+		_, err = tx.Exec(query, uuid.New(), routineID, habitID, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pg *PostgresRoutineStore) GetRoutineByID(userID, id uuid.UUID) (*Routine, error) {
+	routine := &Routine{}
+
+	query := `
+		SELECT id, user_id, name, description, created_at, updated_at
+		FROM routines
+		WHERE id = $1 AND user_id = $2`
+
+	err := pg.db.QueryRow(query, id, userID).Scan(&routine.ID, &routine.UserID, &routine.Name, &routine.Description, &routine.CreatedAt, &routine.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := routineSteps(pg.db, userID, id, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		routine.Habits = append(routine.Habits, step.Habit)
+	}
+
+	return routine, nil
+}
+
+func (pg *PostgresRoutineStore) GetRoutines(userID uuid.UUID) ([]*Routine, error) {
+	query := `
+		SELECT id
+		FROM routines
+		WHERE user_id = $1
+		ORDER BY name`
+
+	rows, err := pg.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var routines []*Routine
+	for _, id := range ids {
+		routine, err := pg.GetRoutineByID(userID, id)
+		if err != nil {
+			return nil, err
+		}
+		if routine != nil {
+			routines = append(routines, routine)
+		}
+	}
+
+	return routines, nil
+}
+
+// UpdateRoutine saves the routine's name and description. A nil habitIDs
+// keeps the current members; otherwise they are replaced in the given order.
+func (pg *PostgresRoutineStore) UpdateRoutine(routine *Routine, habitIDs []uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE routines
+		SET name = $1, description = $2, updated_at = $3
+		WHERE id = $4 AND user_id = $5
+	`
+
+	result, err := tx.Exec(query, routine.Name, routine.Description, time.Now(), routine.ID, routine.UserID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if habitIDs != nil {
+		err = setRoutineHabits(tx, routine.UserID, routine.ID, habitIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresRoutineStore) DeleteRoutine(userID, id uuid.UUID) error {
+	query := `
+		DELETE from routines
+		WHERE id = $1 AND user_id = $2`
+
+	result, err := pg.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetRoutineProgress reports, in order, which member habits already have an
+// entry between from and to.
+func (pg *PostgresRoutineStore) GetRoutineProgress(userID, id uuid.UUID, from, to time.Time) ([]*RoutineStep, error) {
+	return routineSteps(pg.db, userID, id, from, to)
+}
+
+// routineSteps leaves out member habits userID can no longer log, such as
+// those of a group they have left.
+func routineSteps(q queryer, userID, id uuid.UUID, from, to time.Time) ([]*RoutineStep, error) {
+	query := `
+		SELECT rh.position, h.id, h.user_id, h.group_id, h.name, h.description, h.frequency, h.target_count, h.unit, h.target_amount, h.target_duration_seconds, h.polarity, h.is_active, h.freezes_per_month, h.created_at, h.updated_at, h.archived_at,
+			EXISTS (
+				SELECT 1 FROM habit_entries he
+				WHERE he.habit_id = h.id AND he.completion_date >= $3 AND he.completion_date < $4
+			)
+		FROM routine_habits rh
+		INNER JOIN habits h ON h.id = rh.habit_id
+		WHERE rh.routine_id = $1 AND h.deleted_at IS NULL` + loggableBy + `
+		ORDER BY rh.position`
+
+	rows, err := q.Query(query, id, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []*RoutineStep
+	for rows.Next() {
+		habit := &Habit{}
+		step := &RoutineStep{Habit: habit}
+		err := rows.Scan(&step.Position, &habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.Unit, &habit.TargetAmount, &habit.TargetDurationSeconds, &habit.Polarity, &habit.IsActive, &habit.FreezesPerMonth, &habit.CreatedAt, &habit.UpdatedAt, &habit.ArchivedAt, &step.Completed)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
+
+// CompleteRoutine logs an entry by userID for every member habit that has
+// none between from and to, all in one transaction. Habits already done,
+// archived, inactive or tracked as quit habits are left alone. The routine
+// row is locked first, so completing it twice at once logs each habit once.
+func (pg *PostgresRoutineStore) CompleteRoutine(userID, id uuid.UUID, from, to time.Time, note string) ([]*HabitEntry, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var lockedID uuid.UUID
+	err = tx.QueryRow(`SELECT id FROM routines WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID).Scan(&lockedID)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := routineSteps(tx, userID, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*HabitEntry{}
+	for _, step := range steps {
+		habit := step.Habit
+		if step.Completed || habit.ArchivedAt != nil || !habit.IsActive || habit.Polarity == PolarityQuit {
+			continue
+		}
+
+		entry := &HabitEntry{HabitID: habit.ID, Value: 1, Note: note, CompletedBy: &userID}
+		err = insertHabitEntry(tx, entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+// Session is a signed-in device, backed by an authentication token.
+type Session struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	UserAgent  string
+	IP         string
+
+	tokenHash []byte
+}
+
+// UsesToken reports whether the session is backed by the token with hash.
+func (s *Session) UsesToken(hash []byte) bool {
+	return hash != nil && bytes.Equal(s.tokenHash, hash)
+}
+
+// CredentialUsage records one use of either a bearer token, identified by
+// TokenHash, or an API key, identified by APIKeyID.
+type CredentialUsage struct {
+	TokenHash []byte
+	APIKeyID  uuid.UUID
+	UsedAt    time.Time
+	UserAgent string
+	IP        string
+}
+
+// usageBatchSize keeps each batched update well under Postgres's limit on
+// query parameters.
+const usageBatchSize = 500
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db}
+}
+
+type SessionStore interface {
+	GetSessions(userID uuid.UUID) ([]*Session, error)
+	RevokeSession(id, userID uuid.UUID) error
+	RevokeAllSessions(userID uuid.UUID, keepTokenHash []byte) (int64, error)
+	RecordUsage(usages []CredentialUsage) error
+}
+
+// GetSessions lists the user's unexpired authentication tokens, most
+// recently used first.
+func (pg *PostgresSessionStore) GetSessions(userID uuid.UUID) ([]*Session, error) {
+	query := `
+		SELECT id, hash, created_at, expiry, last_used_at, user_agent, ip
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expiry > $3
+		ORDER BY COALESCE(last_used_at, created_at) DESC`
+
+	rows, err := pg.db.Query(query, userID, tokens.ScopeAuth, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session := &Session{}
+		err := rows.Scan(&session.ID, &session.tokenHash, &session.CreatedAt, &session.ExpiresAt, &session.LastUsedAt, &session.UserAgent, &session.IP)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (pg *PostgresSessionStore) RevokeSession(id, userID uuid.UUID) error {
+	result, err := pg.db.Exec(`DELETE FROM tokens WHERE id = $1 AND user_id = $2 AND scope = $3`, id, userID, tokens.ScopeAuth)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RevokeAllSessions signs the user out everywhere, except for the token with
+// keepTokenHash when it is set. It returns how many sessions were ended.
+func (pg *PostgresSessionStore) RevokeAllSessions(userID uuid.UUID, keepTokenHash []byte) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND ($3::bytea IS NULL OR hash <> $3)`
+
+	result, err := pg.db.Exec(query, userID, tokens.ScopeAuth, keepTokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// RecordUsage stores last-used metadata for many credentials at once, with
+// one UPDATE per table and batch rather than one per request.
+func (pg *PostgresSessionStore) RecordUsage(usages []CredentialUsage) error {
+	var tokenUsages, apiKeyUsages []CredentialUsage
+	for _, usage := range usages {
+		if usage.TokenHash != nil {
+			tokenUsages = append(tokenUsages, usage)
+		} else {
+			apiKeyUsages = append(apiKeyUsages, usage)
+		}
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tokenQuery := `
+		UPDATE tokens t
+		SET last_used_at = v.used_at, user_agent = v.user_agent, ip = v.ip
+		FROM (VALUES %s) AS v(hash, used_at, user_agent, ip)
+		WHERE t.hash = v.hash`
+
+	err = execUsageBatches(tx, tokenQuery, "bytea", tokenUsages, func(usage CredentialUsage) any { return usage.TokenHash })
+	if err != nil {
+		return err
+	}
+
+	apiKeyQuery := `
+		UPDATE api_keys k
+		SET last_used_at = v.used_at, user_agent = v.user_agent, ip = v.ip
+		FROM (VALUES %s) AS v(id, used_at, user_agent, ip)
+		WHERE k.id = v.id`
+
+	err = execUsageBatches(tx, apiKeyQuery, "uuid", apiKeyUsages, func(usage CredentialUsage) any { return usage.APIKeyID })
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execUsageBatches fills query's VALUES list from usages, usageBatchSize rows
+// at a time. key picks the column that identifies the credential, which has
+// SQL type keyType.
+func execUsageBatches(tx *sql.Tx, query, keyType string, usages []CredentialUsage, key func(CredentialUsage) any) error {
+	for start := 0; start < len(usages); start += usageBatchSize {
+		batch := usages[start:min(start+usageBatchSize, len(usages))]
+
+		values := make([]string, 0, len(batch))
+		args := make([]any, 0, len(batch)*4)
+		for i, usage := range batch {
+			n := i * 4
+			values = append(values, fmt.Sprintf("($%d::%s, $%d::timestamptz, $%d::text, $%d::varchar)", n+1, keyType, n+2, n+3, n+4))
+			args = append(args, key(usage), usage.UsedAt, usage.UserAgent, usage.IP)
+		}
+
+		_, err := tx.Exec(fmt.Sprintf(query, strings.Join(values, ", ")), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,615 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SyncStatusApplied   = "applied"
+	SyncStatusConflict  = "conflict"
+	SyncStatusInvalid   = "invalid"
+	SyncStatusForbidden = "forbidden"
+)
+
+// syncTables maps a sync resource type to the table that stores it.
+var syncTables = map[string]string{
+	"habit":   "habits",
+	"tag":     "tags",
+	"entry":   "habit_entries",
+	"journal": "journal_entries",
+}
+
+type Tombstone struct {
+	ResourceType string
+	ResourceID   uuid.UUID
+	DeletedAt    time.Time
+}
+
+type SyncChanges struct {
+	Habits  []*Habit
+	Tags    []*Tag
+	Entries []*HabitEntry
+	Journal []*JournalEntry
+	Deleted []*Tombstone
+	// Version is the snapshot horizon to encode in the next change token.
+	Version int64
+	// Reset tells the client to replace its local copy with these changes
+	// instead of merging them. It is set for a first sync and for tokens too
+	// old to cover tombstones that have since been purged.
+	Reset bool
+}
+
+// SyncMutation is a single change recorded by an offline client. UpdatedAt is
+// the client-side modification time used for last-writer-wins resolution.
+type SyncMutation struct {
+	Resource  string        `json:"resource"`
+	Op        string        `json:"op"`
+	ID        uuid.UUID     `json:"id"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Habit     *Habit        `json:"habit,omitempty"`
+	Tag       *Tag          `json:"tag,omitempty"`
+	Entry     *HabitEntry   `json:"entry,omitempty"`
+	Journal   *JournalEntry `json:"journal,omitempty"`
+}
+
+type SyncResult struct {
+	Resource string    `json:"resource"`
+	ID       uuid.UUID `json:"id"`
+	Status   string    `json:"status"`
+}
+
+type PostgresSyncStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSyncStore(db *sql.DB) *PostgresSyncStore {
+	return &PostgresSyncStore{db: db}
+}
+
+type SyncStore interface {
+	GetChangesSince(userID uuid.UUID, version int64) (*SyncChanges, error)
+	ApplyMutations(userID uuid.UUID, mutations []SyncMutation) ([]SyncResult, error)
+	PurgeTombstones(cutoff time.Time) (int64, error)
+}
+
+// changeTokenPrefix marks tokens that hold a snapshot horizon. Tokens without
+// it hold a sync_version from before horizons were used.
+const changeTokenPrefix = "t"
+
+// EncodeChangeToken turns a sync version into the opaque token handed to clients.
+func EncodeChangeToken(version int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(changeTokenPrefix + strconv.FormatInt(version, 10)))
+}
+
+// DecodeChangeToken reverses EncodeChangeToken. An empty token means "from
+// the beginning", and so does an old sync_version token.
+func DecodeChangeToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errors.New("invalid change token")
+	}
+
+	digits, current := strings.CutPrefix(string(raw), changeTokenPrefix)
+	version, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || version < 0 {
+		return 0, errors.New("invalid change token")
+	}
+
+	if !current {
+		return 0, nil
+	}
+
+	return version, nil
+}
+
+// tombstoneOwners looks up the user or group that owns a resource, so its
+// tombstone only syncs to them. Tags are shared and have no owner.
+var tombstoneOwners = map[string]string{
+	"habit": `SELECT user_id, group_id FROM habits WHERE id = $1`,
+	"entry": `
+		SELECT h.user_id, h.group_id
+		FROM habit_entries e
+		INNER JOIN habits h ON h.id = e.habit_id
+		WHERE e.id = $1`,
+	"journal": `SELECT user_id, NULL::uuid FROM journal_entries WHERE id = $1`,
+}
+
+// recordTombstone has to run before the resource is deleted, while its owner
+// can still be looked up.
+func recordTombstone(tx *sql.Tx, resourceType string, id uuid.UUID) error {
+	var userID, groupID *uuid.UUID
+	if ownerQuery, ok := tombstoneOwners[resourceType]; ok {
+		err := tx.QueryRow(ownerQuery, id).Scan(&userID, &groupID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO tombstones (id, resource_type, resource_id, user_id, group_id)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := tx.Exec(query, uuid.New(), resourceType, id, userID, groupID)
+	return err
+}
+
+func tombstoneHabitEntries(tx *sql.Tx, habitID uuid.UUID) error {
+	rows, err := tx.Query(`SELECT id FROM habit_entries WHERE habit_id = $1`, habitID)
+	if err != nil {
+		return err
+	}
+
+	var entryIDs []uuid.UUID
+	for rows.Next() {
+		var entryID uuid.UUID
+		if err := rows.Scan(&entryID); err != nil {
+			rows.Close()
+			return err
+		}
+		entryIDs = append(entryIDs, entryID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entryID := range entryIDs {
+		err = recordTombstone(tx, "entry", entryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetChangesSince returns what changed for the user since version, which is
+// the snapshot horizon of an earlier call: every transaction below it had
+// finished by then. Rows written from the horizon on are sent again, since
+// they may have been committed after that snapshot, so clients apply
+// changes idempotently.
+func (pg *PostgresSyncStore) GetChangesSince(userID uuid.UUID, version int64) (*SyncChanges, error) {
+	tx, err := pg.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The first statement fixes the transaction's snapshot, so the horizon
+	// describes exactly what the queries below can see.
+	var horizon, purgedThrough int64
+	err = tx.QueryRow(`SELECT txid_snapshot_xmin(txid_current_snapshot()), purged_through FROM sync_horizon`).Scan(&horizon, &purgedThrough)
+	if err != nil {
+		return nil, err
+	}
+
+	if version <= purgedThrough {
+		version = 0
+	}
+
+	changes := &SyncChanges{Version: horizon, Reset: version == 0}
+
+	habitRows, err := tx.Query(`
+		SELECT id, user_id, group_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, created_at, updated_at
+		FROM habits
+		WHERE sync_txid >= $2 AND deleted_at IS NULL`+visibleTo+`
+		ORDER BY sync_version`, userID, version)
+	if err != nil {
+		return nil, err
+	}
+	for habitRows.Next() {
+		habit := &Habit{}
+		err := habitRows.Scan(&habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.Unit, &habit.TargetAmount, &habit.TargetDurationSeconds, &habit.Polarity, &habit.IsActive, &habit.CreatedAt, &habit.UpdatedAt)
+		if err != nil {
+			habitRows.Close()
+			return nil, err
+		}
+		changes.Habits = append(changes.Habits, habit)
+	}
+	habitRows.Close()
+	if err = habitRows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := tx.Query(`
+		SELECT id, name, color, created_at, updated_at
+		FROM tags
+		WHERE sync_txid >= $1 AND deleted_at IS NULL
+		ORDER BY sync_version`, version)
+	if err != nil {
+		return nil, err
+	}
+	for tagRows.Next() {
+		tag := &Tag{}
+		err := tagRows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		if err != nil {
+			tagRows.Close()
+			return nil, err
+		}
+		changes.Tags = append(changes.Tags, tag)
+	}
+	tagRows.Close()
+	if err = tagRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Entries of trashed habits were tombstoned with the habit.
+	entryRows, err := tx.Query(`
+		SELECT e.id, e.habit_id, e.completion_date, e.value, e.duration_seconds, e.note, e.completed_by, e.updated_at
+		FROM habit_entries e
+		INNER JOIN habits h ON h.id = e.habit_id
+		WHERE e.sync_txid >= $2 AND h.deleted_at IS NULL`+visibleTo+`
+		ORDER BY e.sync_version`, userID, version)
+	if err != nil {
+		return nil, err
+	}
+	for entryRows.Next() {
+		entry := &HabitEntry{}
+		err := entryRows.Scan(&entry.ID, &entry.HabitID, &entry.Completion, &entry.Value, &entry.DurationSeconds, &entry.Note, &entry.CompletedBy, &entry.UpdatedAt)
+		if err != nil {
+			entryRows.Close()
+			return nil, err
+		}
+		changes.Entries = append(changes.Entries, entry)
+	}
+	entryRows.Close()
+	if err = entryRows.Err(); err != nil {
+		return nil, err
+	}
+
+	journalRows, err := tx.Query(`
+		SELECT id, user_id, entry_date, body, mood, energy, created_at, updated_at
+		FROM journal_entries
+		WHERE user_id = $1 AND sync_txid >= $2
+		ORDER BY sync_version`, userID, version)
+	if err != nil {
+		return nil, err
+	}
+	for journalRows.Next() {
+		entry := &JournalEntry{}
+		err := journalRows.Scan(&entry.ID, &entry.UserID, &entry.Date, &entry.Body, &entry.Mood, &entry.Energy, &entry.CreatedAt, &entry.UpdatedAt)
+		if err != nil {
+			journalRows.Close()
+			return nil, err
+		}
+		changes.Journal = append(changes.Journal, entry)
+	}
+	journalRows.Close()
+	if err = journalRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A client starting over has nothing to delete.
+	if changes.Reset {
+		return changes, nil
+	}
+
+	tombstoneRows, err := tx.Query(`
+		SELECT resource_type, resource_id, deleted_at
+		FROM tombstones
+		WHERE sync_txid >= $2`+visibleTo+`
+		ORDER BY sync_version`, userID, version)
+	if err != nil {
+		return nil, err
+	}
+	defer tombstoneRows.Close()
+
+	for tombstoneRows.Next() {
+		tombstone := &Tombstone{}
+		err := tombstoneRows.Scan(&tombstone.ResourceType, &tombstone.ResourceID, &tombstone.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes.Deleted = append(changes.Deleted, tombstone)
+	}
+	if err = tombstoneRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// PurgeTombstones deletes tombstones older than cutoff and moves the sync
+// horizon past them, so clients that never saw them resync from scratch.
+func (pg *PostgresSyncStore) PurgeTombstones(cutoff time.Time) (int64, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH purged AS (
+			DELETE FROM tombstones WHERE deleted_at < $1 RETURNING sync_txid
+		)
+		SELECT COUNT(*), MAX(sync_txid) FROM purged`
+
+	var purged int64
+	var purgedThrough sql.NullInt64
+	err = tx.QueryRow(query, cutoff).Scan(&purged, &purgedThrough)
+	if err != nil {
+		return 0, err
+	}
+
+	if purgedThrough.Valid {
+		_, err = tx.Exec(`UPDATE sync_horizon SET purged_through = GREATEST(purged_through, $1)`, purgedThrough.Int64)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// ApplyMutations applies a batch from userID's offline client. Rows the user
+// may not change are reported as forbidden and left alone.
+func (pg *PostgresSyncStore) ApplyMutations(userID uuid.UUID, mutations []SyncMutation) ([]SyncResult, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]SyncResult, 0, len(mutations))
+	for _, m := range mutations {
+		status, err := applyMutation(tx, userID, m)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, SyncResult{Resource: m.Resource, ID: m.ID, Status: status})
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// syncAccess reports whether user $2 may change the existing row $1 of a
+// resource type. Tags are shared, so anyone may.
+var syncAccess = map[string]string{
+	"habit": `SELECT EXISTS (SELECT 1 FROM habits h WHERE h.id = $1` + managedBy + `)`,
+	"entry": `
+		SELECT EXISTS (
+			SELECT 1 FROM habit_entries e
+			INNER JOIN habits h ON h.id = e.habit_id
+			WHERE e.id = $1` + loggableBy + `
+		)`,
+	"journal": `SELECT EXISTS (SELECT 1 FROM journal_entries WHERE id = $1 AND user_id = $2)`,
+}
+
+func applyMutation(tx *sql.Tx, userID uuid.UUID, m SyncMutation) (string, error) {
+	table, ok := syncTables[m.Resource]
+	if !ok || m.ID == uuid.Nil || m.UpdatedAt.IsZero() {
+		return SyncStatusInvalid, nil
+	}
+
+	exists, newer, err := lastWriterWins(tx, table, m.Resource, m.ID, m.UpdatedAt)
+	if err != nil {
+		return "", err
+	}
+
+	if accessQuery, ok := syncAccess[m.Resource]; exists && ok {
+		var allowed bool
+		err = tx.QueryRow(accessQuery, m.ID, userID).Scan(&allowed)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			return SyncStatusForbidden, nil
+		}
+	}
+
+	if !newer {
+		return SyncStatusConflict, nil
+	}
+
+	switch m.Op {
+	case "delete":
+		if !exists {
+			return SyncStatusApplied, nil
+		}
+		if m.Resource == "entry" || m.Resource == "journal" {
+			err = recordTombstone(tx, m.Resource, m.ID)
+			if err != nil {
+				return "", err
+			}
+			_, err = tx.Exec(`DELETE FROM `+table+` WHERE id = $1`, m.ID)
+			if err != nil {
+				return "", err
+			}
+			return SyncStatusApplied, nil
+		}
+		// Habits and tags go to the trash, mirroring DeleteHabit and DeleteTag.
+		_, err = tx.Exec(`UPDATE `+table+` SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL`, m.UpdatedAt, m.ID)
+		if err != nil {
+			return "", err
+		}
+		if m.Resource == "habit" {
+			err = tombstoneHabitEntries(tx, m.ID)
+			if err != nil {
+				return "", err
+			}
+		}
+		return SyncStatusApplied, recordTombstone(tx, m.Resource, m.ID)
+	case "upsert":
+		return upsertSyncResource(tx, userID, m, exists)
+	default:
+		return SyncStatusInvalid, nil
+	}
+}
+
+// lastWriterWins locks the server copy of a resource and reports whether the
+// client's modification time is newer than both the stored row and any
+// tombstone left behind by a delete.
+func lastWriterWins(tx *sql.Tx, table, resource string, id uuid.UUID, clientUpdatedAt time.Time) (exists bool, newer bool, err error) {
+	var serverUpdatedAt time.Time
+	err = tx.QueryRow(`SELECT updated_at FROM `+table+` WHERE id = $1 FOR UPDATE`, id).Scan(&serverUpdatedAt)
+	if err == nil {
+		return true, clientUpdatedAt.After(serverUpdatedAt), nil
+	}
+	if err != sql.ErrNoRows {
+		return false, false, err
+	}
+
+	var deletedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT MAX(deleted_at)
+		FROM tombstones
+		WHERE resource_type = $1 AND resource_id = $2`, resource, id).Scan(&deletedAt)
+	if err != nil {
+		return false, false, err
+	}
+
+	return false, !deletedAt.Valid || clientUpdatedAt.After(deletedAt.Time), nil
+}
+
+// upsertSyncResource writes a resource the user may change. New habits and
+// journal entries belong to the user, and new entries are logged by them.
+func upsertSyncResource(tx *sql.Tx, userID uuid.UUID, m SyncMutation, exists bool) (string, error) {
+	var err error
+
+	switch m.Resource {
+	case "habit":
+		h := m.Habit
+		if h == nil || h.Name == "" || h.Frequency == "" {
+			return SyncStatusInvalid, nil
+		}
+		polarity := h.Polarity
+		if polarity == "" {
+			polarity = PolarityBuild
+		}
+		if polarity != PolarityBuild && polarity != PolarityQuit {
+			return SyncStatusInvalid, nil
+		}
+		if exists {
+			_, err = tx.Exec(`
+				UPDATE habits
+				SET name = $1, description = $2, frequency = $3, target_count = $4, unit = $5, target_amount = $6, target_duration_seconds = $7, polarity = $8, is_active = $9, updated_at = $10, deleted_at = NULL
+				WHERE id = $11`,
+				h.Name, h.Description, h.Frequency, h.TargetCount, h.Unit, h.TargetAmount, h.TargetDurationSeconds, polarity, h.IsActive, m.UpdatedAt, m.ID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO habits (id, user_id, name, description, frequency, target_count, unit, target_amount, target_duration_seconds, polarity, is_active, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+				m.ID, userID, h.Name, h.Description, h.Frequency, h.TargetCount, h.Unit, h.TargetAmount, h.TargetDurationSeconds, polarity, h.IsActive, m.UpdatedAt)
+		}
+		if err == nil {
+			err = recordHabitVersion(tx, m.ID)
+		}
+	case "tag":
+		t := m.Tag
+		if t == nil || t.Name == "" {
+			return SyncStatusInvalid, nil
+		}
+		var nameTaken bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM tags WHERE name = $1 AND id <> $2 AND deleted_at IS NULL)`, t.Name, m.ID).Scan(&nameTaken)
+		if err != nil {
+			return "", err
+		}
+		if nameTaken {
+			return SyncStatusConflict, nil
+		}
+		if exists {
+			_, err = tx.Exec(`
+				UPDATE tags
+				SET name = $1, color = $2, updated_at = $3, deleted_at = NULL
+				WHERE id = $4`,
+				t.Name, t.Color, m.UpdatedAt, m.ID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO tags (id, name, color, updated_at)
+				VALUES ($1, $2, $3, $4)`,
+				m.ID, t.Name, t.Color, m.UpdatedAt)
+		}
+	case "entry":
+		e := m.Entry
+		if e == nil || e.HabitID == uuid.Nil || e.Value < 0 || e.DurationSeconds < 0 {
+			return SyncStatusInvalid, nil
+		}
+		var habitExists, mayLog bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM habits h WHERE h.id = $1 AND h.deleted_at IS NULL),
+				EXISTS (SELECT 1 FROM habits h WHERE h.id = $1 AND h.deleted_at IS NULL`+loggableBy+`)`,
+			e.HabitID, userID).Scan(&habitExists, &mayLog)
+		if err != nil {
+			return "", err
+		}
+		if !habitExists {
+			return SyncStatusInvalid, nil
+		}
+		if !mayLog {
+			return SyncStatusForbidden, nil
+		}
+		completion := e.Completion
+		if completion.IsZero() {
+			completion = m.UpdatedAt
+		}
+		// An entry sent without a value is a plain completion.
+		value := e.Value
+		if value == 0 {
+			value = 1
+		}
+		if exists {
+			_, err = tx.Exec(`
+				UPDATE habit_entries
+				SET habit_id = $1, completion_date = $2, value = $3, duration_seconds = $4, note = $5, updated_at = $6
+				WHERE id = $7`,
+				e.HabitID, completion, value, e.DurationSeconds, e.Note, m.UpdatedAt, m.ID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO habit_entries (id, habit_id, completion_date, value, duration_seconds, note, completed_by, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				m.ID, e.HabitID, completion, value, e.DurationSeconds, e.Note, userID, m.UpdatedAt)
+		}
+	case "journal":
+		j := m.Journal
+		if j == nil || j.Date.IsZero() || !ValidRating(j.Mood) || !ValidRating(j.Energy) {
+			return SyncStatusInvalid, nil
+		}
+		var dateTaken bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM journal_entries WHERE user_id = $1 AND entry_date = $2 AND id <> $3)`, userID, j.Date, m.ID).Scan(&dateTaken)
+		if err != nil {
+			return "", err
+		}
+		if dateTaken {
+			return SyncStatusConflict, nil
+		}
+		if exists {
+			_, err = tx.Exec(`
+				UPDATE journal_entries
+				SET entry_date = $1, body = $2, mood = $3, energy = $4, updated_at = $5
+				WHERE id = $6`,
+				j.Date, j.Body, j.Mood, j.Energy, m.UpdatedAt, m.ID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO journal_entries (id, user_id, entry_date, body, mood, energy, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				m.ID, userID, j.Date, j.Body, j.Mood, j.Energy, m.UpdatedAt)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return SyncStatusApplied, nil
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeChangeToken(t *testing.T) {
+	legacy := base64.RawURLEncoding.EncodeToString([]byte("42"))
+
+	tests := []struct {
+		name    string
+		token   string
+		want    int64
+		wantErr bool
+	}{
+		{"empty token starts from the beginning", "", 0, false},
+		{"round trip", EncodeChangeToken(1234), 1234, false},
+		{"zero horizon", EncodeChangeToken(0), 0, false},
+		{"sync_version token starts over", legacy, 0, false},
+		{"not base64", "%%%", 0, true},
+		{"not a number", base64.RawURLEncoding.EncodeToString([]byte("tabc")), 0, true},
+		{"negative", base64.RawURLEncoding.EncodeToString([]byte("t-5")), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeChangeToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("version = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ type Tag struct {
 	Color     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	DeletedAt *time.Time
 }
 
 type PostgresTagStore struct {
@@ -31,6 +32,7 @@ type TagStore interface {
 	GetTags() ([]*Tag, error)
 	UpdateTag(*Tag) error
 	DeleteTag(id uuid.UUID) error
+	RestoreTag(id uuid.UUID) error
 }
 
 func (pg *PostgresTagStore) CreateTag(tag *Tag) (*Tag, error) {
@@ -68,7 +70,7 @@ func (pg *PostgresTagStore) GetTagByID(id uuid.UUID) (*Tag, error) {
 	query := `
 		SELECT id, name, color, created_at, updated_at
 		FROM tags
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	err := pg.db.QueryRow(query, id).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
 	if err == sql.ErrNoRows {
@@ -86,6 +88,7 @@ func (pg *PostgresTagStore) GetTags() ([]*Tag, error) {
 	query := `
 		SELECT id, name, color, created_at, updated_at
 		FROM tags
+		WHERE deleted_at IS NULL
 		ORDER BY name`
 
 	rows, err := pg.db.Query(query)
@@ -120,7 +123,7 @@ func (pg *PostgresTagStore) UpdateTag(tag *Tag) error {
 
 	query := `UPDATE tags
 		SET name = $1, color = $2, updated_at = $3
-		WHERE id = $4
+		WHERE id = $4 AND deleted_at IS NULL
 	`
 
 	result, err := tx.Exec(query, tag.Name, tag.Color, time.Now(), tag.ID)
@@ -140,13 +143,52 @@ func (pg *PostgresTagStore) UpdateTag(tag *Tag) error {
 	return tx.Commit()
 }
 
+// DeleteTag moves a tag to the trash; its habit associations survive until purge.
 func (pg *PostgresTagStore) DeleteTag(id uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tags
+		SET deleted_at = $1, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := tx.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = recordTombstone(tx, "tag", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresTagStore) RestoreTag(id uuid.UUID) error {
 	query := `
-		DELETE from tags
-		WHERE id = $1`
+		UPDATE tags
+		SET deleted_at = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NOT NULL`
 
-	result, err := pg.db.Exec(query, id)
+	result, err := pg.db.Exec(query, time.Now(), id)
 	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return errors.New("tag with this name already exists")
+		}
 		return err
 	}
 
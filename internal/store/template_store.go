@@ -0,0 +1,295 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HabitTemplate is a ready-made habit. Built-in templates come from the
+// embedded catalog and are identified by their file name; private templates
+// belong to a user and are identified by a UUID.
+type HabitTemplate struct {
+	ID          string
+	UserID      *uuid.UUID
+	Name        string
+	Description string
+	Frequency   string
+	TargetCount int
+	Tags        []string
+	CreatedAt   *time.Time
+}
+
+// LoadTemplates reads the built-in catalog, one JSON file per template.
+func LoadTemplates(templatesFS fs.FS, dir string) ([]*HabitTemplate, error) {
+	files, err := fs.Glob(templatesFS, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var catalog []*HabitTemplate
+	for _, file := range files {
+		data, err := fs.ReadFile(templatesFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("templates: read %s: %w", file, err)
+		}
+
+		var definition struct {
+			Name        string   `json:"name"`
+			Description string   `json:"description"`
+			Frequency   string   `json:"frequency"`
+			TargetCount int      `json:"target_count"`
+			Tags        []string `json:"tags"`
+		}
+
+		err = json.Unmarshal(data, &definition)
+		if err != nil {
+			return nil, fmt.Errorf("templates: parse %s: %w", file, err)
+		}
+
+		catalog = append(catalog, &HabitTemplate{
+			ID:          strings.TrimSuffix(path.Base(file), ".json"),
+			Name:        definition.Name,
+			Description: definition.Description,
+			Frequency:   definition.Frequency,
+			TargetCount: definition.TargetCount,
+			Tags:        definition.Tags,
+		})
+	}
+
+	return catalog, nil
+}
+
+type PostgresTemplateStore struct {
+	db      *sql.DB
+	catalog []*HabitTemplate
+}
+
+func NewPostgresTemplateStore(db *sql.DB, catalog []*HabitTemplate) *PostgresTemplateStore {
+	return &PostgresTemplateStore{db: db, catalog: catalog}
+}
+
+type TemplateStore interface {
+	GetTemplates(userID uuid.UUID) ([]*HabitTemplate, error)
+	GetTemplateByID(userID uuid.UUID, id string) (*HabitTemplate, error)
+	SaveHabitAsTemplate(userID, habitID uuid.UUID) (*HabitTemplate, error)
+	DeleteTemplate(userID, id uuid.UUID) error
+	InstantiateTemplate(template *HabitTemplate, ownerID *uuid.UUID) (*Habit, []*Tag, error)
+}
+
+const templateColumns = `
+		SELECT id, user_id, name, description, frequency, target_count, tags, created_at
+		FROM habit_templates`
+
+// GetTemplates returns the built-in catalog followed by the user's private
+// templates.
+func (pg *PostgresTemplateStore) GetTemplates(userID uuid.UUID) ([]*HabitTemplate, error) {
+	query := templateColumns + `
+		WHERE user_id = $1
+		ORDER BY name`
+
+	private, err := pg.queryTemplates(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := append([]*HabitTemplate{}, pg.catalog...)
+	return append(templates, private...), nil
+}
+
+// GetTemplateByID looks up a built-in template, or one of the user's private
+// templates when id is a UUID. Other users' templates are never returned.
+func (pg *PostgresTemplateStore) GetTemplateByID(userID uuid.UUID, id string) (*HabitTemplate, error) {
+	templateID, err := uuid.Parse(id)
+	if err != nil {
+		for _, template := range pg.catalog {
+			if template.ID == id {
+				return template, nil
+			}
+		}
+		return nil, nil
+	}
+
+	query := templateColumns + `
+		WHERE id = $1 AND user_id = $2`
+
+	templates, err := pg.queryTemplates(query, templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	return templates[0], nil
+}
+
+func (pg *PostgresTemplateStore) queryTemplates(query string, args ...any) ([]*HabitTemplate, error) {
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*HabitTemplate
+	for rows.Next() {
+		template := &HabitTemplate{}
+		var id uuid.UUID
+		var tags []byte
+		err := rows.Scan(&id, &template.UserID, &template.Name, &template.Description, &template.Frequency, &template.TargetCount, &tags, &template.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		template.ID = id.String()
+		err = json.Unmarshal(tags, &template.Tags)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// SaveHabitAsTemplate copies a habit and the names of its tags into a new
+// private template. It returns nil if the habit does not exist or userID
+// may not read it.
+func (pg *PostgresTemplateStore) SaveHabitAsTemplate(userID, habitID uuid.UUID) (*HabitTemplate, error) {
+	id := uuid.New()
+
+	query := `
+		INSERT INTO habit_templates (id, user_id, name, description, frequency, target_count, tags)
+		SELECT $1, $2, h.name, COALESCE(h.description, ''), h.frequency, COALESCE(h.target_count, 1),
+			COALESCE((
+				SELECT jsonb_agg(t.name ORDER BY t.name)
+				FROM habit_tags ht
+				INNER JOIN tags t ON t.id = ht.tag_id
+				WHERE ht.habit_id = h.id AND t.deleted_at IS NULL
+			), '[]')
+		FROM habits h
+		WHERE h.id = $3 AND h.deleted_at IS NULL` + readableBy
+
+	result, err := pg.db.Exec(query, id, userID, habitID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	return pg.GetTemplateByID(userID, id.String())
+}
+
+func (pg *PostgresTemplateStore) DeleteTemplate(userID, id uuid.UUID) error {
+	query := `
+		DELETE from habit_templates
+		WHERE id = $1 AND user_id = $2`
+
+	result, err := pg.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// InstantiateTemplate creates a habit from a template in one transaction.
+// Suggested tags are matched by name against active tags and created when
+// missing, then attached to the new habit.
+func (pg *PostgresTemplateStore) InstantiateTemplate(template *HabitTemplate, ownerID *uuid.UUID) (*Habit, []*Tag, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	habit, tags, err := instantiateTemplate(tx, template, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return habit, tags, nil
+}
+
+// instantiateTemplate creates a habit owned by ownerID from the template
+// inside tx, creating any of the template's tags that don't exist yet.
+func instantiateTemplate(tx *sql.Tx, template *HabitTemplate, ownerID *uuid.UUID) (*Habit, []*Tag, error) {
+	habit := &Habit{
+		UserID:      ownerID,
+		Name:        template.Name,
+		Description: template.Description,
+		Frequency:   template.Frequency,
+		TargetCount: template.TargetCount,
+		IsActive:    true,
+	}
+
+	err := insertHabit(tx, habit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := []*Tag{}
+	for _, name := range template.Tags {
+		tag := &Tag{}
+
+		query := `
+			SELECT id, name, color, created_at, updated_at
+			FROM tags
+			WHERE name = $1 AND deleted_at IS NULL`
+
+		err = tx.QueryRow(query, name).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		if err == sql.ErrNoRows {
+			query = `
+				INSERT INTO tags (id, name)
+				VALUES ($1, $2)
+				RETURNING id, name, color, created_at, updated_at`
+
+			err = tx.QueryRow(query, uuid.New(), name).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, err = tx.Exec(`INSERT INTO habit_tags (id, habit_id, tag_id) VALUES ($1, $2, $3)`, uuid.New(), habit.ID, tag.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return habit, tags, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+type PostgresTokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db}
+}
+
+type TokenStore interface {
+	CreateNewToken(userID uuid.UUID, ttl time.Duration, scope string) (*tokens.Token, error)
+	Insert(token *tokens.Token) error
+	DeleteAllTokensForUser(userID uuid.UUID, scope string) error
+}
+
+func (pg *PostgresTokenStore) CreateNewToken(userID uuid.UUID, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.Insert(token)
+	return token, err
+}
+
+func (pg *PostgresTokenStore) Insert(token *tokens.Token) error {
+	query := `
+		INSERT INTO tokens (id, hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := pg.db.Exec(query, token.ID, token.Hash, token.UserID, token.Expiry, token.Scope)
+	return err
+}
+
+func (pg *PostgresTokenStore) DeleteAllTokensForUser(userID uuid.UUID, scope string) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = $2`
+
+	_, err := pg.db.Exec(query, userID, scope)
+	return err
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Trash struct {
+	Habits []*Habit
+	Tags   []*Tag
+}
+
+type PostgresTrashStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTrashStore(db *sql.DB) *PostgresTrashStore {
+	return &PostgresTrashStore{db: db}
+}
+
+type TrashStore interface {
+	GetTrash(userID uuid.UUID) (*Trash, error)
+	PurgeDeletedBefore(cutoff time.Time) (int64, error)
+}
+
+// GetTrash lists the trashed habits userID may list and every trashed tag,
+// since tags are shared.
+func (pg *PostgresTrashStore) GetTrash(userID uuid.UUID) (*Trash, error) {
+	trash := &Trash{}
+
+	habitQuery := `
+		SELECT id, user_id, group_id, name, description, frequency, target_count, is_active, created_at, updated_at, deleted_at
+		FROM habits
+		WHERE deleted_at IS NOT NULL` + visibleTo + `
+		ORDER BY deleted_at DESC`
+
+	habitRows, err := pg.db.Query(habitQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer habitRows.Close()
+
+	for habitRows.Next() {
+		habit := &Habit{}
+		err := habitRows.Scan(&habit.ID, &habit.UserID, &habit.GroupID, &habit.Name, &habit.Description, &habit.Frequency, &habit.TargetCount, &habit.IsActive, &habit.CreatedAt, &habit.UpdatedAt, &habit.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		trash.Habits = append(trash.Habits, habit)
+	}
+
+	if err = habitRows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagQuery := `
+		SELECT id, name, color, created_at, updated_at, deleted_at
+		FROM tags
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`
+
+	tagRows, err := pg.db.Query(tagQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		tag := &Tag{}
+		err := tagRows.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.UpdatedAt, &tag.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		trash.Tags = append(trash.Tags, tag)
+	}
+
+	if err = tagRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trash, nil
+}
+
+// PurgeDeletedBefore permanently removes habits and tags trashed before cutoff.
+// ON DELETE CASCADE takes their entries and habit_tags rows with them; the sync
+// tombstones were already written when they were trashed.
+func (pg *PostgresTrashStore) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	habitResult, err := tx.Exec(`DELETE FROM habits WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	tagResult, err := tx.Exec(`DELETE FROM tags WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	habitsPurged, err := habitResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	tagsPurged, err := tagResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return habitsPurged + tagsPurged, nil
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+)
+
+// TwoFactor is a user's TOTP enrolment. It only protects logins once
+// EnabledAt is set.
+type TwoFactor struct {
+	UserID    uuid.UUID
+	Secret    string
+	EnabledAt *time.Time
+	// LastStep is the time step of the last accepted code, so a code can't
+	// be used twice.
+	LastStep *int64
+}
+
+func (tf *TwoFactor) Enabled() bool {
+	return tf != nil && tf.EnabledAt != nil
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{db: db}
+}
+
+type TwoFactorStore interface {
+	GetTwoFactor(userID uuid.UUID) (*TwoFactor, error)
+	StartEnrolment(userID uuid.UUID, secret string) error
+	EnableTwoFactor(userID uuid.UUID, recoveryCodes []string) error
+	DisableTwoFactor(userID uuid.UUID) error
+	RecordStep(userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uuid.UUID, recoveryCodes []string) error
+	UseRecoveryCode(userID uuid.UUID, code string) (bool, error)
+	CountRecoveryCodes(userID uuid.UUID) (int, error)
+}
+
+// GetTwoFactor returns nil when the user has never started enrolling.
+func (pg *PostgresTwoFactorStore) GetTwoFactor(userID uuid.UUID) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, enabled_at, last_step
+		FROM user_totp
+		WHERE user_id = $1`
+
+	tf := &TwoFactor{}
+	err := pg.db.QueryRow(query, userID).Scan(&tf.UserID, &tf.Secret, &tf.EnabledAt, &tf.LastStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+// StartEnrolment stores a new, not yet enabled secret, replacing any
+// unfinished enrolment. It returns sql.ErrNoRows if 2FA is already enabled.
+func (pg *PostgresTwoFactorStore) StartEnrolment(userID uuid.UUID, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.enabled_at IS NULL`
+
+	result, err := pg.db.Exec(query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EnableTwoFactor turns on the pending enrolment and stores the hashes of
+// its recovery codes.
+func (pg *PostgresTwoFactorStore) EnableTwoFactor(userID uuid.UUID, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND enabled_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = insertRecoveryCodes(tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRecoveryCodes(tx *sql.Tx, userID uuid.UUID, recoveryCodes []string) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (id, user_id, hash) VALUES ($1, $2, $3)`, uuid.New(), userID, tokens.Hash(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pg *PostgresTwoFactorStore) DisableTwoFactor(userID uuid.UUID) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordStep marks a code's time step as used. It reports false when that
+// step, or a later one, was already used, which means the code is a replay.
+func (pg *PostgresTwoFactorStore) RecordStep(userID uuid.UUID, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_step = $1
+		WHERE user_id = $2 AND (last_step IS NULL OR last_step < $1)`
+
+	result, err := pg.db.Exec(query, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (pg *PostgresTwoFactorStore) ReplaceRecoveryCodes(userID uuid.UUID, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertRecoveryCodes(tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode spends an unused recovery code, reporting whether it was
+// valid.
+func (pg *PostgresTwoFactorStore) UseRecoveryCode(userID uuid.UUID, code string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	result, err := pg.db.Exec(query, userID, tokens.Hash(code))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (pg *PostgresTwoFactorStore) CountRecoveryCodes(userID uuid.UUID) (int, error) {
+	var count int
+	err := pg.db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,252 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevin120202/habit-tracker/internal/tokens"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type password struct {
+	plainText *string
+	hash      []byte
+}
+
+func (p *password) Set(plainTextPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	p.plainText = &plainTextPassword
+	p.hash = hash
+	return nil
+}
+
+func (p *password) Matches(plainTextPassword string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plainTextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type User struct {
+	ID           uuid.UUID
+	Username     string
+	Email        string
+	PasswordHash password `json:"-"`
+	FirstName    string
+	LastName     string
+	Role         string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// DeactivatedAt is set when an admin has locked the account.
+	DeactivatedAt *time.Time
+	// EmailVerifiedAt is set once the user has confirmed their email address.
+	EmailVerifiedAt *time.Time
+	// DeleteAfter is set while the user's account is scheduled for deletion.
+	DeleteAfter *time.Time
+}
+
+// AnonymousUser is attached to requests that carry no credentials.
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+func (u *User) IsVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+type PostgresUserStore struct {
+	db *sql.DB
+}
+
+func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
+	return &PostgresUserStore{db: db}
+}
+
+type UserStore interface {
+	CreateUser(*User) error
+	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserToken(scope, tokenPlaintext string) (*User, error)
+	GetUserByID(id uuid.UUID) (*User, error)
+	GetUsers() ([]*User, error)
+	UpdatePassword(*User) error
+	UpdateRole(id uuid.UUID, role string) error
+	SetDeactivated(id uuid.UUID, deactivated bool) error
+	SetEmailVerified(id uuid.UUID) error
+}
+
+func (pg *PostgresUserStore) CreateUser(user *User) error {
+	user.ID = uuid.New()
+
+	query := `
+		INSERT INTO users (id, username, email, password, first_name, last_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING role, created_at, updated_at`
+
+	err := pg.db.QueryRow(query, user.ID, user.Username, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName).Scan(&user.Role, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			return errors.New("username or email already taken")
+		}
+		return err
+	}
+
+	return nil
+}
+
+const userColumns = `
+		SELECT u.id, u.username, u.email, u.password, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), u.role, u.created_at, u.updated_at, u.deactivated_at, u.email_verified_at, u.delete_after`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	user := &User{}
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.DeactivatedAt, &user.EmailVerifiedAt, &user.DeleteAfter)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (pg *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
+	query := userColumns + `
+		FROM users u
+		WHERE u.username = $1`
+
+	return scanUser(pg.db.QueryRow(query, username))
+}
+
+// GetUserByEmail matches email case-insensitively.
+func (pg *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	query := userColumns + `
+		FROM users u
+		WHERE LOWER(u.email) = LOWER($1)`
+
+	return scanUser(pg.db.QueryRow(query, email))
+}
+
+// GetUserToken returns the owner of an unexpired token with the given scope.
+func (pg *PostgresUserStore) GetUserToken(scope, tokenPlaintext string) (*User, error) {
+	query := userColumns + `
+		FROM users u
+		INNER JOIN tokens t ON t.user_id = u.id
+		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3 AND u.deactivated_at IS NULL`
+
+	return scanUser(pg.db.QueryRow(query, tokens.Hash(tokenPlaintext), scope, time.Now()))
+}
+
+func (pg *PostgresUserStore) GetUserByID(id uuid.UUID) (*User, error) {
+	query := userColumns + `
+		FROM users u
+		WHERE u.id = $1`
+
+	return scanUser(pg.db.QueryRow(query, id))
+}
+
+// GetUsers returns every account, oldest first.
+func (pg *PostgresUserStore) GetUsers() ([]*User, error) {
+	query := userColumns + `
+		FROM users u
+		ORDER BY u.created_at`
+
+	rows, err := pg.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UpdatePassword stores the hash set on user.PasswordHash.
+func (pg *PostgresUserStore) UpdatePassword(user *User) error {
+	query := `
+		UPDATE users
+		SET password = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING updated_at`
+
+	return pg.db.QueryRow(query, user.PasswordHash.hash, user.ID).Scan(&user.UpdatedAt)
+}
+
+func (pg *PostgresUserStore) UpdateRole(id uuid.UUID, role string) error {
+	return pg.execUserUpdate(`UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, role, id)
+}
+
+// SetDeactivated locks or unlocks an account. Tokens of a deactivated user
+// stop authenticating straight away.
+func (pg *PostgresUserStore) SetDeactivated(id uuid.UUID, deactivated bool) error {
+	var deactivatedAt *time.Time
+	if deactivated {
+		now := time.Now()
+		deactivatedAt = &now
+	}
+
+	return pg.execUserUpdate(`UPDATE users SET deactivated_at = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, deactivatedAt, id)
+}
+
+// SetEmailVerified marks the user's email address as confirmed. Verifying
+// twice keeps the original timestamp.
+func (pg *PostgresUserStore) SetEmailVerified(id uuid.UUID) error {
+	return pg.execUserUpdate(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+}
+
+func (pg *PostgresUserStore) execUserUpdate(query string, args ...any) error {
+	result, err := pg.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
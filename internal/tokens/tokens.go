@@ -0,0 +1,73 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeAuth          = "authentication"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+	// ScopeTwoFactor tokens stand in for a correct password while a login
+	// waits for its second factor.
+	ScopeTwoFactor = "two-factor"
+)
+
+// Token is a bearer token handed to a client. Only the SHA-256 hash of the
+// plaintext is ever stored.
+type Token struct {
+	// ID identifies the token when listing and revoking sessions.
+	ID        uuid.UUID `json:"id"`
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func GenerateToken(userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		ID:     uuid.New(),
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Hash = Hash(token.Plaintext)
+
+	return token, nil
+}
+
+// Hash returns the stored form of a plaintext token.
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// APIKeyPrefix starts every API key so they are easy to recognise in config
+// files and secret scanners.
+const APIKeyPrefix = "hk_"
+
+// GenerateAPIKey returns a new API key in plaintext. Like tokens, only its
+// Hash is stored.
+func GenerateAPIKey() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
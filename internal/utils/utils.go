@@ -3,7 +3,10 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -70,3 +73,41 @@ func ReadTagIDParam(r *http.Request) (uuid.UUID, error) {
 
 	return tagID, nil
 }
+
+// ReadUUIDParam reads a named chi URL parameter and parses it as a UUID.
+func ReadUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	param := chi.URLParam(r, name)
+
+	if param == "" {
+		return uuid.Nil, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	id, err := uuid.Parse(param)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s parameter type", name)
+	}
+
+	return id, nil
+}
+
+// DateLayout is the format used for calendar dates in requests and query strings.
+const DateLayout = "2006-01-02"
+
+// ParseDate parses a YYYY-MM-DD calendar date.
+func ParseDate(value string) (time.Time, error) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+
+	return date, nil
+}
+
+// ClientIP returns the address of the client that sent r, without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/kevin120202/habit-tracker/internal/app"
@@ -12,15 +13,29 @@ import (
 
 func main() {
 	var port int
+	var trashRetention, tombstoneRetention time.Duration
 	flag.IntVar(&port, "port", 8080, "go backend server port")
+	flag.DurationVar(&trashRetention, "trash-retention", 30*24*time.Hour, "how long deleted habits and tags stay in the trash")
+	flag.DurationVar(&tombstoneRetention, "tombstone-retention", 90*24*time.Hour, "how long sync clients can stay offline before they have to resync from scratch")
+	var config app.Config
+	flag.DurationVar(&config.AccountDeletionGrace, "account-deletion-grace", 14*24*time.Hour, "how long a deleted account can be restored before it is purged")
+	flag.StringVar(&config.OIDC.Issuer, "oidc-issuer", "", "OpenID Connect issuer URL; leave empty to disable single sign-on")
+	flag.StringVar(&config.OIDC.ClientID, "oidc-client-id", "", "OpenID Connect client id")
+	flag.StringVar(&config.OIDC.ClientSecret, "oidc-client-secret", os.Getenv("OIDC_CLIENT_SECRET"), "OpenID Connect client secret (defaults to $OIDC_CLIENT_SECRET)")
+	flag.StringVar(&config.OIDC.RedirectURL, "oidc-redirect-url", "", "callback URL registered with the provider, ending in /oidc/callback")
 	flag.Parse()
 
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(config)
 	if err != nil {
 		panic(err)
 	}
 	defer app.DB.Close()
 
+	app.StartTrashPurge(trashRetention)
+	app.StartTombstonePurge(tombstoneRetention)
+	app.StartAccountPurge()
+	app.StartUsageFlush()
+
 	r := routes.SetupRoutes(app)
 
 	http.HandleFunc("/health", app.HealthCheck)
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE IF NOT EXISTS sync_version_seq;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habit_entries
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION bump_sync_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_version := nextval('sync_version_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER habits_sync_version BEFORE INSERT OR UPDATE ON habits
+    FOR EACH ROW EXECUTE PROCEDURE bump_sync_version();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER tags_sync_version BEFORE INSERT OR UPDATE ON tags
+    FOR EACH ROW EXECUTE PROCEDURE bump_sync_version();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER habit_entries_sync_version BEFORE INSERT OR UPDATE ON habit_entries
+    FOR EACH ROW EXECUTE PROCEDURE bump_sync_version();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS habit_entries_sync_version ON habit_entries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS tags_sync_version ON tags;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS habits_sync_version ON habits;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS bump_sync_version();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habit_entries DROP COLUMN sync_version, DROP COLUMN updated_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags DROP COLUMN sync_version;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN sync_version;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP SEQUENCE IF EXISTS sync_version_seq;
+-- +goose StatementEnd
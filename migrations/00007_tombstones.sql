@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tombstones (
+    id UUID PRIMARY KEY,
+    resource_type VARCHAR(20) NOT NULL,
+    resource_id UUID NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq')
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE tombstones;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS tags_name_active_idx ON tags (name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tags_name_active_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DELETE FROM tags WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags ADD CONSTRAINT tags_name_key UNIQUE (name);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE tags DROP COLUMN deleted_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DELETE FROM habits WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN deleted_at;
+-- +goose StatementEnd
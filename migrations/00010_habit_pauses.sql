@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_pauses (
+    id UUID PRIMARY KEY,
+    habit_id UUID NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    end_date DATE,
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date IS NULL OR end_date >= start_date)
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE habit_pauses;
+-- +goose StatementEnd
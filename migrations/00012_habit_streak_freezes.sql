@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS freezes_per_month INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN freezes_per_month;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits
+    ADD COLUMN IF NOT EXISTS unit VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS target_amount NUMERIC(12, 2);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habit_entries ADD COLUMN IF NOT EXISTS value NUMERIC(12, 2) NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habit_entries DROP COLUMN value;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN target_amount, DROP COLUMN unit;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS target_duration_seconds INTEGER;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habit_entries ADD COLUMN IF NOT EXISTS duration_seconds INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habit_entries DROP COLUMN duration_seconds;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN target_duration_seconds;
+-- +goose StatementEnd
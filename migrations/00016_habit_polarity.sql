@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE habits ADD COLUMN IF NOT EXISTS polarity VARCHAR(10) NOT NULL DEFAULT 'build' CHECK (polarity IN ('build', 'quit'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habits DROP COLUMN polarity;
+-- +goose StatementEnd
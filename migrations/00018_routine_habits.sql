@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS routine_habits (
+    id UUID PRIMARY KEY,
+    routine_id UUID NOT NULL REFERENCES routines(id) ON DELETE CASCADE,
+    habit_id UUID NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (routine_id, habit_id)
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE routine_habits;
+-- +goose StatementEnd
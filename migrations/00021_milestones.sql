@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS milestones (
+    id UUID PRIMARY KEY,
+    goal_id UUID NOT NULL UNIQUE REFERENCES goals(id) ON DELETE CASCADE,
+    achieved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE milestones;
+-- +goose StatementEnd
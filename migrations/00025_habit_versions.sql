@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS habit_versions (
+    id UUID PRIMARY KEY,
+    habit_id UUID NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    frequency VARCHAR(20) NOT NULL,
+    target_count INTEGER,
+    target_amount NUMERIC,
+    target_duration_seconds INTEGER,
+    effective_from TIMESTAMP WITH TIME ZONE NOT NULL
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX habit_versions_habit_idx ON habit_versions (habit_id, effective_from)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO habit_versions (id, habit_id, name, frequency, target_count, target_amount, target_duration_seconds, effective_from)
+SELECT md5(random()::text || id::text)::uuid, id, name, frequency, target_count, target_amount, target_duration_seconds, created_at
+FROM habits
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE habit_versions;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id UUID PRIMARY KEY,
+    entry_date DATE NOT NULL UNIQUE,
+    body TEXT NOT NULL DEFAULT '',
+    mood SMALLINT CHECK (mood BETWEEN 1 AND 5),
+    energy SMALLINT CHECK (energy BETWEEN 1 AND 5),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sync_version BIGINT NOT NULL DEFAULT nextval('sync_version_seq')
+)
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER journal_entries_sync_version BEFORE INSERT OR UPDATE ON journal_entries
+    FOR EACH ROW EXECUTE PROCEDURE bump_sync_version();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE journal_entries;
+-- +goose StatementEnd
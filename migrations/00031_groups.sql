@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS groups (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX group_members_user_id_idx ON group_members (user_id);
+
+ALTER TABLE habits ADD COLUMN group_id UUID REFERENCES groups(id) ON DELETE CASCADE;
+ALTER TABLE habits ADD CONSTRAINT habits_single_owner CHECK (user_id IS NULL OR group_id IS NULL);
+
+ALTER TABLE habit_entries ADD COLUMN completed_by UUID REFERENCES users(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE habit_entries DROP COLUMN completed_by;
+ALTER TABLE habits DROP CONSTRAINT habits_single_owner;
+ALTER TABLE habits DROP COLUMN group_id;
+DROP TABLE group_members;
+DROP TABLE groups;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens
+    ADD COLUMN id UUID,
+    ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Existing tokens get a stable id derived from their hash.
+UPDATE tokens SET id = md5(hash::text)::uuid;
+
+ALTER TABLE tokens ALTER COLUMN id SET NOT NULL;
+
+CREATE UNIQUE INDEX tokens_id_idx ON tokens (id);
+CREATE INDEX tokens_user_id_scope_idx ON tokens (user_id, scope);
+
+ALTER TABLE api_keys
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip VARCHAR(64) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE api_keys DROP COLUMN ip, DROP COLUMN user_agent;
+DROP INDEX tokens_user_id_scope_idx;
+ALTER TABLE tokens DROP COLUMN ip, DROP COLUMN user_agent, DROP COLUMN last_used_at, DROP COLUMN created_at, DROP COLUMN id;
+-- +goose StatementEnd
@@ -0,0 +1,90 @@
+-- +goose Up
+-- +goose StatementBegin
+-- sync_txid is the transaction that last wrote a row. Change tokens are
+-- transaction snapshot horizons rather than sync_version, since sequence
+-- values are handed out before commit and can become visible out of order.
+ALTER TABLE habits ADD COLUMN sync_txid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tags ADD COLUMN sync_txid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE habit_entries ADD COLUMN sync_txid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE journal_entries ADD COLUMN sync_txid BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tombstones ADD COLUMN sync_txid BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE habits ALTER COLUMN sync_txid SET DEFAULT txid_current();
+ALTER TABLE tags ALTER COLUMN sync_txid SET DEFAULT txid_current();
+ALTER TABLE habit_entries ALTER COLUMN sync_txid SET DEFAULT txid_current();
+ALTER TABLE journal_entries ALTER COLUMN sync_txid SET DEFAULT txid_current();
+ALTER TABLE tombstones ALTER COLUMN sync_txid SET DEFAULT txid_current();
+
+CREATE INDEX habits_sync_txid_idx ON habits (sync_txid);
+CREATE INDEX tags_sync_txid_idx ON tags (sync_txid);
+CREATE INDEX habit_entries_sync_txid_idx ON habit_entries (sync_txid);
+CREATE INDEX journal_entries_sync_txid_idx ON journal_entries (sync_txid);
+CREATE INDEX tombstones_sync_txid_idx ON tombstones (sync_txid);
+
+CREATE OR REPLACE FUNCTION bump_sync_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_version := nextval('sync_version_seq');
+    NEW.sync_txid := txid_current();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Tombstones are only sent to the user or group that owned the deleted
+-- resource. Tag and journal tombstones have neither, like tags and journal
+-- entries themselves.
+ALTER TABLE tombstones
+    ADD COLUMN user_id UUID,
+    ADD COLUMN group_id UUID;
+
+UPDATE tombstones t
+SET user_id = h.user_id, group_id = h.group_id
+FROM habits h
+WHERE t.resource_type = 'habit' AND h.id = t.resource_id;
+
+UPDATE tombstones t
+SET user_id = h.user_id, group_id = h.group_id
+FROM habit_entries e
+INNER JOIN habits h ON h.id = e.habit_id
+WHERE t.resource_type = 'entry' AND e.id = t.resource_id;
+
+-- Tokens issued before this migration force a full resync, so tombstones
+-- whose owner can no longer be found aren't needed by anyone.
+DELETE FROM tombstones
+WHERE resource_type NOT IN ('tag', 'journal') AND user_id IS NULL AND group_id IS NULL
+    AND NOT EXISTS (SELECT 1 FROM habits h WHERE h.id = tombstones.resource_id AND h.user_id IS NULL AND h.group_id IS NULL)
+    AND NOT EXISTS (
+        SELECT 1 FROM habit_entries e
+        INNER JOIN habits h ON h.id = e.habit_id
+        WHERE e.id = tombstones.resource_id AND h.user_id IS NULL AND h.group_id IS NULL
+    );
+
+CREATE INDEX tombstones_deleted_at_idx ON tombstones (deleted_at);
+
+-- purged_through is the newest sync_txid among purged tombstones. Clients
+-- whose token doesn't cover it may have missed a deletion and must resync.
+CREATE TABLE sync_horizon (
+    purged_through BIGINT NOT NULL
+);
+
+INSERT INTO sync_horizon (purged_through) VALUES (0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sync_horizon;
+DROP INDEX tombstones_deleted_at_idx;
+ALTER TABLE tombstones DROP COLUMN group_id, DROP COLUMN user_id;
+
+CREATE OR REPLACE FUNCTION bump_sync_version() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_version := nextval('sync_version_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE tombstones DROP COLUMN sync_txid;
+ALTER TABLE journal_entries DROP COLUMN sync_txid;
+ALTER TABLE habit_entries DROP COLUMN sync_txid;
+ALTER TABLE tags DROP COLUMN sync_txid;
+ALTER TABLE habits DROP COLUMN sync_txid;
+-- +goose StatementEnd
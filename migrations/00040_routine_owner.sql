@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Routines created before they had owners keep a NULL user_id and are no
+-- longer served to anyone.
+ALTER TABLE routines ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX routines_user_id_idx ON routines (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE routines DROP COLUMN user_id;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Entries written before journals had owners keep a NULL user_id and are no
+-- longer served to anyone.
+ALTER TABLE journal_entries
+    ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    DROP CONSTRAINT journal_entries_entry_date_key,
+    ADD CONSTRAINT journal_entries_user_id_entry_date_key UNIQUE (user_id, entry_date);
+
+-- Tombstones are only sent to the owner from now on, and the ones already
+-- recorded belong to entries nobody owns.
+DELETE FROM tombstones WHERE resource_type = 'journal';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE journal_entries
+    DROP CONSTRAINT journal_entries_user_id_entry_date_key,
+    DROP COLUMN user_id,
+    ADD CONSTRAINT journal_entries_entry_date_key UNIQUE (entry_date);
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Each user runs their own timer on a habit, so group members can time the
+-- same habit at once. Anonymous timers on ownerless habits keep a NULL user_id.
+ALTER TABLE habit_timers ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE habit_timers DROP CONSTRAINT habit_timers_pkey;
+
+CREATE UNIQUE INDEX habit_timers_habit_id_user_id_key
+    ON habit_timers (habit_id, COALESCE(user_id, '00000000-0000-0000-0000-000000000000'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX habit_timers_habit_id_user_id_key;
+
+DELETE FROM habit_timers a
+USING habit_timers b
+WHERE a.habit_id = b.habit_id AND a.started_at > b.started_at;
+
+ALTER TABLE habit_timers DROP COLUMN user_id;
+
+ALTER TABLE habit_timers ADD PRIMARY KEY (habit_id);
+-- +goose StatementEnd
@@ -0,0 +1,6 @@
+package templates
+
+import "embed"
+
+//go:embed *.json
+var FS embed.FS // FS holds the built-in habit template catalog, one `.json` file per template